@@ -1,23 +1,192 @@
 package KubeClient
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// inClusterNamespaceFile holds the namespace of the service account mounted
+// into every pod.
+const inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Options controls how NewClient resolves the cluster configuration.
+type Options struct {
+	// Kubeconfig is a kubeconfig path or a list of paths joined with the OS
+	// path list separator, like KUBECONFIG. Empty means KUBECONFIG or
+	// ~/.kube/config.
+	Kubeconfig string
+	// Context selects a kubeconfig context instead of current-context.
+	Context string
+	// Namespace overrides the namespace of the selected context.
+	Namespace string
+	// DisableInCluster turns off the rest.InClusterConfig fallback used when
+	// no kubeconfig is available.
+	DisableInCluster bool
+	// Tool names the program in the audit log, the binary name by default.
+	Tool string
+	// AuditLog is the audit log path, KUBECLIENT_AUDIT_LOG or
+	// DefaultAuditLogPath when empty, and "off" to disable it.
+	AuditLog string
+	// AuditWebhook receives every audit entry as a JSON POST,
+	// KUBECLIENT_AUDIT_WEBHOOK when empty.
+	AuditWebhook string
+	// Policy is the protected namespace policy file, KUBECLIENT_POLICY or
+	// DefaultPolicyPath when empty.
+	Policy string
+	// OverrideProtected skips the confirmation for protected namespaces. Its
+	// use is recorded in the audit log.
+	OverrideProtected bool
+}
+
+// Client bundles everything the tools need to talk to a cluster.
+type Client struct {
+	Config    *rest.Config
+	Clientset kubernetes.Interface
+	Executor  Executor
+	// Namespace is the default namespace taken from Options, the kubeconfig
+	// context or the in-cluster service account, in that order.
+	Namespace string
+	// Context is the kubeconfig context in use, empty when running in-cluster.
+	Context   string
+	InCluster bool
+	// Audit records the execs and mutating calls made through the client,
+	// nil when auditing is off.
+	Audit *AuditLog
+	// Guard enforces the protected namespace policy, nil without a policy.
+	Guard *Guard
+}
+
+// BindFlags registers the kubeconfig, context and override-protected flags
+// on fs.
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "(optional) kubeconfig path, or a list of paths as in KUBECONFIG")
+	fs.StringVar(&o.Context, "context", o.Context, "(optional) kubeconfig context to use")
+	fs.BoolVar(&o.OverrideProtected, "override-protected", o.OverrideProtected, "do not ask before working in protected namespaces, recorded in the audit log")
+}
+
+// NewClient builds a Client from the kubeconfig chain described by opts,
+// falling back to the in-cluster service account when no kubeconfig exists.
+// Execs and mutating API calls are recorded in the audit log, and execs in
+// protected namespaces need a confirmation.
+func NewClient(opts Options) (*Client, error) {
+	client, err := loadConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Audit, err = newAuditLog(opts, client)
+	if err != nil {
+		return nil, err
+	}
+	if client.Audit != nil {
+		client.Config.Wrap(client.Audit.WrapTransport)
+	}
+
+	clientset, err := kubernetes.NewForConfig(client.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ClientSet: %w", err)
+	}
+	client.Clientset = clientset
+
+	client.Guard, err = newGuard(opts, client)
+	if err != nil {
+		return nil, err
+	}
+	client.Executor = client.Guard.Executor(client.Audit.Executor(NewExecutor(client.Config, clientset)))
+
+	return client, nil
+}
+
+// BuildClient loads a single kubeconfig file.
+//
+// Deprecated: use NewClient, which also handles contexts, KUBECONFIG lists
+// and in-cluster configuration.
 func BuildClient(kubeconfig string) (*rest.Config, *kubernetes.Clientset, error) {
-	restcfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	client, err := loadConfig(Options{Kubeconfig: kubeconfig, DisableInCluster: true})
 	if err != nil {
-		return nil, nil, fmt.Errorf("error building ClientSet config: %w", err)
+		return nil, nil, err
 	}
 
-	clientset, err := kubernetes.NewForConfig(restcfg)
+	clientset, err := kubernetes.NewForConfig(client.Config)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error creating ClientSet: %w", err)
 	}
 
-	return restcfg, clientset, nil
+	return client.Config, clientset, nil
+}
+
+func loadConfig(opts Options) (*Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if opts.Kubeconfig != "" {
+		paths := filepath.SplitList(opts.Kubeconfig)
+		if len(paths) == 1 {
+			rules.ExplicitPath = paths[0]
+		} else {
+			rules.Precedence = paths
+		}
+	}
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+	overrides.Context.Namespace = opts.Namespace
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	rawcfg, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig: %w", err)
+	}
+
+	if len(rawcfg.Contexts) == 0 && opts.Context == "" && !opts.DisableInCluster {
+		return loadInClusterConfig(opts)
+	}
+
+	restcfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error building ClientSet config: %w", err)
+	}
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("error resolving default namespace: %w", err)
+	}
+
+	context_name := opts.Context
+	if context_name == "" {
+		context_name = rawcfg.CurrentContext
+	}
+
+	return &Client{
+		Config:    restcfg,
+		Namespace: namespace,
+		Context:   context_name,
+	}, nil
+}
+
+func loadInClusterConfig(opts Options) (*Client, error) {
+	restcfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("no kubeconfig found and in-cluster config unavailable: %w", err)
+	}
+
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = "default"
+		if data, err := os.ReadFile(inClusterNamespaceFile); err == nil {
+			if ns := strings.TrimSpace(string(data)); ns != "" {
+				namespace = ns
+			}
+		}
+	}
+
+	return &Client{
+		Config:    restcfg,
+		Namespace: namespace,
+		InCluster: true,
+	}, nil
 }
@@ -0,0 +1,319 @@
+package KubeClient
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// CastSession is the metadata krc stores in the header of a recording, on
+// top of the fields defined by asciicast v2.
+type CastSession struct {
+	User      string     `json:"user"`
+	Cluster   string     `json:"cluster"`
+	Context   string     `json:"context,omitempty"`
+	Namespace string     `json:"namespace"`
+	Pod       string     `json:"pod"`
+	Container string     `json:"container"`
+	Command   []string   `json:"command,omitempty"`
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+}
+
+// CastHeader is the first line of an asciicast v2 file.
+type CastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Duration  float64           `json:"duration,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Session   *CastSession      `json:"session,omitempty"`
+}
+
+// CastEvent is one "o" (output) or "r" (resize) event of a recording.
+type CastEvent struct {
+	Time float64
+	Type string
+	Data string
+}
+
+func (e *CastEvent) UnmarshalJSON(data []byte) error {
+	var fields []interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("asciicast event has %d fields, expected 3", len(fields))
+	}
+
+	t, ok1 := fields[0].(float64)
+	kind, ok2 := fields[1].(string)
+	text, ok3 := fields[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return fmt.Errorf("malformed asciicast event %s", data)
+	}
+
+	e.Time, e.Type, e.Data = t, kind, text
+	return nil
+}
+
+func (e CastEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Type, e.Data})
+}
+
+// Recorder writes the output of a TTY session as an asciicast v2 file. The
+// session is written to a .part file that Close turns into the final file,
+// with the end time and duration filled in. Every line goes to the file as
+// soon as it is recorded, so a session killed before Close, as TTY.Safe does
+// on SIGHUP, still leaves a .part file ReadCast can play.
+type Recorder struct {
+	Path string
+
+	mu      sync.Mutex
+	file    *os.File
+	header  CastHeader
+	start   time.Time
+	pending []byte
+	err     error
+}
+
+// NewRecorder starts a recording in dir for session, sized width x height.
+func NewRecorder(dir string, session CastSession, width int, height int) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating recording directory: %w", err)
+	}
+
+	start := time.Now()
+	session.Start = start
+	name := fmt.Sprintf("%s-%s-%s.cast", start.Format("20060102-150405"), session.Namespace, session.Pod)
+	path := filepath.Join(dir, name)
+
+	file, err := os.OpenFile(path+".part", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating recording: %w", err)
+	}
+
+	r := &Recorder{
+		Path:  path,
+		file:  file,
+		start: start,
+		header: CastHeader{
+			Version:   2,
+			Width:     width,
+			Height:    height,
+			Timestamp: start.Unix(),
+			Title:     fmt.Sprintf("%s/%s (%s)", session.Namespace, session.Pod, session.Container),
+			Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": strings.Join(session.Command, " ")},
+			Session:   &session,
+		},
+	}
+	if err := r.writeLine(r.header); err != nil {
+		file.Close()
+		os.Remove(path + ".part")
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Recorder) writeLine(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := r.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing recording: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Recorder) event(kind string, data string) {
+	if r.err != nil {
+		return
+	}
+	r.err = r.writeLine(CastEvent{Time: time.Since(r.start).Seconds(), Type: kind, Data: data})
+}
+
+// Output records p as terminal output. A rune split across writes is held
+// back until it is complete, since events must be valid UTF-8.
+func (r *Recorder) Output(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.event("o", string(data[:cut]))
+	}
+}
+
+// Resize records a change of terminal size.
+func (r *Recorder) Resize(size remotecommand.TerminalSize) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.event("r", fmt.Sprintf("%dx%d", size.Width, size.Height))
+}
+
+// Tee returns a writer that records everything written to w.
+func (r *Recorder) Tee(w io.Writer) io.Writer {
+	return recorderWriter{w: w, r: r}
+}
+
+type recorderWriter struct {
+	w io.Writer
+	r *Recorder
+}
+
+func (t recorderWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.r.Output(p[:n])
+	return n, err
+}
+
+// Sizes returns a queue that records the sizes it passes on from queue.
+func (r *Recorder) Sizes(queue remotecommand.TerminalSizeQueue) remotecommand.TerminalSizeQueue {
+	return recorderQueue{queue: queue, r: r}
+}
+
+type recorderQueue struct {
+	queue remotecommand.TerminalSizeQueue
+	r     *Recorder
+}
+
+func (q recorderQueue) Next() *remotecommand.TerminalSize {
+	size := q.queue.Next()
+	if size != nil {
+		q.r.Resize(*size)
+	}
+	return size
+}
+
+// Close finishes the recording and moves it to Path. It reports the first
+// write error seen during the session.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = fmt.Errorf("error writing recording: %w", err)
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	end := time.Now()
+	r.header.Duration = end.Sub(r.start).Seconds()
+	r.header.Session.End = &end
+
+	return finishRecording(r.Path+".part", r.Path, r.header)
+}
+
+// finishRecording copies the events of part after an updated header into
+// path and removes part.
+func finishRecording(part string, path string, header CastHeader) error {
+	src, err := os.Open(part)
+	if err != nil {
+		return fmt.Errorf("error reading recording: %w", err)
+	}
+	defer src.Close()
+
+	reader := bufio.NewReader(src)
+	if _, err := reader.ReadString('\n'); err != nil {
+		return fmt.Errorf("error reading recording header: %w", err)
+	}
+
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creating recording: %w", err)
+	}
+	w := bufio.NewWriter(dst)
+
+	data, err := json.Marshal(header)
+	if err == nil {
+		_, err = w.Write(append(data, '\n'))
+	}
+	if err == nil {
+		_, err = io.Copy(w, reader)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("error writing recording: %w", err)
+	}
+
+	return os.Remove(part)
+}
+
+// ReadCast parses an asciicast v2 recording, also one left as .part by an
+// interrupted session.
+func ReadCast(r io.Reader) (CastHeader, []CastEvent, error) {
+	var header CastHeader
+	var events []CastEvent
+
+	reader := bufio.NewReader(r)
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return header, nil, fmt.Errorf("empty recording: %w", err)
+	}
+	if err := json.Unmarshal([]byte(line), &header); err != nil {
+		return header, nil, fmt.Errorf("invalid asciicast header: %w", err)
+	}
+	if header.Version != 2 {
+		return header, nil, fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+
+	for n := 2; ; n++ {
+		line, err := reader.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			var event CastEvent
+			if jsonErr := json.Unmarshal([]byte(line), &event); jsonErr != nil {
+				// A session cut short may leave half a line at the end.
+				if err == io.EOF {
+					break
+				}
+				return header, nil, fmt.Errorf("line %d: %w", n, jsonErr)
+			}
+			events = append(events, event)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return header, nil, err
+		}
+	}
+
+	return header, events, nil
+}
@@ -0,0 +1,37 @@
+package KubeClient_test
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// TestRecorderWritesBeforeClose reads the .part file of a session that never
+// reached Close, as when the terminal is closed under it.
+func TestRecorderWritesBeforeClose(t *testing.T) {
+	session := KubeClient.CastSession{Namespace: "ns", Pod: "odoo", Container: "odoo"}
+	recorder, err := KubeClient.NewRecorder(t.TempDir(), session, 80, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Tee(io.Discard).Write([]byte("$ ls\r\n"))
+
+	part, err := os.Open(recorder.Path + ".part")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer part.Close()
+
+	header, events, err := KubeClient.ReadCast(part)
+	if err != nil {
+		t.Fatalf("ReadCast: %v", err)
+	}
+	if header.Session == nil || header.Session.Pod != "odoo" {
+		t.Errorf("header has session %+v", header.Session)
+	}
+	if len(events) != 1 || events[0].Type != "o" || events[0].Data != "$ ls\r\n" {
+		t.Errorf("events are %+v", events)
+	}
+}
@@ -0,0 +1,304 @@
+package KubeClient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables configuring the audit log when Options leaves it
+// unset. Setting AuditLogEnv to "off" disables it.
+const (
+	AuditLogEnv     = "KUBECLIENT_AUDIT_LOG"
+	AuditWebhookEnv = "KUBECLIENT_AUDIT_WEBHOOK"
+)
+
+// auditWebhookTimeout bounds how long a tool waits for the webhook.
+const auditWebhookTimeout = 5 * time.Second
+
+// AuditEntry is one line of the audit log: who did what against which
+// cluster, namespace and pod, and how it ended.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Tool      string    `json:"tool"`
+	User      string    `json:"user"`
+	Cluster   string    `json:"cluster"`
+	Context   string    `json:"context,omitempty"`
+	Action    string    `json:"action"`
+	Namespace string    `json:"namespace,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Command   []string  `json:"command,omitempty"`
+	// Resource is the API path of a mutating call.
+	Resource string `json:"resource,omitempty"`
+	// ExitCode is the remote exit status of an exec, or the HTTP status of an
+	// API call. It is -1 when the action failed before completing.
+	ExitCode int               `json:"exit_code"`
+	Error    string            `json:"error,omitempty"`
+	Duration float64           `json:"duration_seconds"`
+	Details  map[string]string `json:"details,omitempty"`
+}
+
+// AuditLog appends AuditEntry lines to a local file and optionally posts
+// them to a webhook. A nil *AuditLog records nothing.
+type AuditLog struct {
+	Path    string
+	Webhook string
+	Tool    string
+	User    string
+	Cluster string
+	Context string
+
+	mu     sync.Mutex
+	warned bool
+	http   *http.Client
+}
+
+// DefaultAuditLogPath is ~/.local/state/kubeclient/audit.jsonl.
+func DefaultAuditLogPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating the audit log: %w", err)
+	}
+
+	return filepath.Join(home, ".local", "state", "kubeclient", "audit.jsonl"), nil
+}
+
+// newAuditLog sets up the audit log described by opts and the environment,
+// nil when it is turned off.
+func newAuditLog(opts Options, client *Client) (*AuditLog, error) {
+	path := opts.AuditLog
+	if path == "" {
+		path = os.Getenv(AuditLogEnv)
+	}
+	if path == "off" {
+		return nil, nil
+	}
+	if path == "" {
+		var err error
+		if path, err = DefaultAuditLogPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	webhook := opts.AuditWebhook
+	if webhook == "" {
+		webhook = os.Getenv(AuditWebhookEnv)
+	}
+
+	tool := opts.Tool
+	if tool == "" {
+		tool = filepath.Base(os.Args[0])
+	}
+
+	username := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+
+	return &AuditLog{
+		Path:    path,
+		Webhook: webhook,
+		Tool:    tool,
+		User:    username,
+		Cluster: client.Config.Host,
+		Context: client.Context,
+		http:    &http.Client{Timeout: auditWebhookTimeout},
+	}, nil
+}
+
+// Record fills in who and where, then appends entry to the log. Failures
+// are reported once on stderr and otherwise ignored, so a full disk or a
+// dead webhook never blocks the work being audited.
+func (a *AuditLog) Record(entry AuditEntry) {
+	if a == nil {
+		return
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Tool, entry.User, entry.Cluster, entry.Context = a.Tool, a.User, a.Cluster, a.Context
+
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = a.append(append(data, '\n'))
+	}
+	if err == nil && a.Webhook != "" {
+		err = a.post(data)
+	}
+	if err != nil {
+		a.warn(err)
+	}
+}
+
+func (a *AuditLog) append(line []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	// A single write keeps lines from concurrent tools whole.
+	_, err = f.Write(line)
+	if close_err := f.Close(); err == nil {
+		err = close_err
+	}
+	return err
+}
+
+func (a *AuditLog) post(data []byte) error {
+	resp, err := a.http.Post(a.Webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (a *AuditLog) warn(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.warned {
+		a.warned = true
+		fmt.Fprintf(os.Stderr, "Warning: audit log %s: %s\n", a.Path, err)
+	}
+}
+
+// Executor wraps executor so every command it runs is recorded, once when it
+// starts and once with its outcome.
+func (a *AuditLog) Executor(executor Executor) Executor {
+	if a == nil {
+		return executor
+	}
+
+	return &auditedExecutor{executor: executor, audit: a}
+}
+
+type auditedExecutor struct {
+	executor Executor
+	audit    *AuditLog
+}
+
+// Stream records the command before running it as well as after. TTY.Safe
+// exits the process on SIGHUP and SIGTERM, so a shell ended by closing its
+// terminal only leaves the start entry.
+func (e *auditedExecutor) Stream(ctx context.Context, opts ExecOptions) error {
+	action := "exec"
+	if opts.TTY {
+		action = "exec-tty"
+	}
+
+	start := time.Now()
+	e.audit.Record(AuditEntry{
+		Time:      start,
+		Action:    action + "-start",
+		Namespace: opts.Namespace,
+		Pod:       opts.Pod,
+		Container: opts.Container,
+		Command:   opts.Command,
+	})
+
+	err := e.executor.Stream(ctx, opts)
+
+	entry := AuditEntry{
+		Time:      start,
+		Action:    action,
+		Namespace: opts.Namespace,
+		Pod:       opts.Pod,
+		Container: opts.Container,
+		Command:   opts.Command,
+		Duration:  time.Since(start).Seconds(),
+	}
+
+	var exit_err *ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exit_err):
+		entry.ExitCode = exit_err.Code
+	default:
+		entry.ExitCode = -1
+		entry.Error = err.Error()
+	}
+	e.audit.Record(entry)
+
+	return err
+}
+
+// WrapTransport records the mutating API calls going through rt. Reads are
+// not recorded, nor exec and attach, which the audited Executor covers.
+func (a *AuditLog) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &auditTransport{rt: rt, audit: a}
+}
+
+type auditTransport struct {
+	rt    http.RoundTripper
+	audit *AuditLog
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.rt.RoundTrip(req)
+	}
+	if strings.HasSuffix(req.URL.Path, "/exec") || strings.HasSuffix(req.URL.Path, "/attach") {
+		return t.rt.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+
+	entry := AuditEntry{
+		Time:     start,
+		Action:   strings.ToLower(req.Method),
+		Resource: req.URL.Path,
+		Duration: time.Since(start).Seconds(),
+	}
+	entry.Namespace, entry.Pod = podFromPath(req.URL.Path)
+	if err != nil {
+		entry.ExitCode = -1
+		entry.Error = err.Error()
+	} else {
+		entry.ExitCode = resp.StatusCode
+	}
+	t.audit.Record(entry)
+
+	return resp, err
+}
+
+// podFromPath extracts the namespace and pod of an API path such as
+// /api/v1/namespaces/NS/pods/NAME/ephemeralcontainers.
+func podFromPath(path string) (string, string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	var namespace, pod string
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case "namespaces":
+			namespace = parts[i+1]
+		case "pods":
+			pod = parts[i+1]
+		}
+	}
+
+	return namespace, pod
+}
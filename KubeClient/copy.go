@@ -0,0 +1,540 @@
+package KubeClient
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PodPath addresses a file or directory inside a pod container.
+type PodPath struct {
+	Namespace string
+	Pod       string
+	Container string
+	Path      string
+}
+
+func (p PodPath) String() string {
+	return p.Namespace + "/" + p.Pod + ":" + p.Path
+}
+
+// CopyProgress is reported after every archive entry is transferred.
+type CopyProgress struct {
+	// Path is the entry just transferred, relative to the copy root.
+	Path string
+	// Files and Bytes are running totals of entries and file content bytes.
+	Files int
+	Bytes int64
+}
+
+// CopyOptions tunes a copy. The zero value is ready to use.
+type CopyOptions struct {
+	Progress func(CopyProgress)
+}
+
+type copyCounter struct {
+	progress func(CopyProgress)
+	files    int
+	bytes    int64
+}
+
+func (c *copyCounter) add(name string, size int64) {
+	c.files++
+	c.bytes += size
+	if c.progress != nil {
+		c.progress(CopyProgress{Path: name, Files: c.files, Bytes: c.bytes})
+	}
+}
+
+// CopyFromPod copies src out of a pod as a tar stream, like kubectl cp. When
+// dst is an existing directory src is placed inside it, otherwise dst names
+// the copy. Permissions, modification times and symlinks are preserved.
+func CopyFromPod(ctx context.Context, executor Executor, src PodPath, dst string, opts CopyOptions) error {
+	src_path := path.Clean(src.Path)
+	target := dst
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		target = filepath.Join(dst, path.Base(src_path))
+	}
+
+	reader := streamFromPod(ctx, executor, src)
+	defer reader.Close()
+
+	counter := &copyCounter{progress: opts.Progress}
+	err := untarLocal(tar.NewReader(reader), path.Base(src_path), target, counter)
+	if err == nil {
+		err = drainArchive(reader)
+	}
+	if err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", src, dst, err)
+	}
+
+	return nil
+}
+
+// CopyToPod copies the local file or directory src into a pod. dst.Path
+// names the copy; parent directories are created as needed. The pod only
+// needs tar and sh.
+func CopyToPod(ctx context.Context, executor Executor, src string, dst PodPath, opts CopyOptions) error {
+	dst_path := path.Clean(dst.Path)
+	counter := &copyCounter{progress: opts.Progress}
+
+	reader, writer := io.Pipe()
+	tar_err := make(chan error, 1)
+	go func() {
+		tw := tar.NewWriter(writer)
+		err := tarLocal(tw, src, path.Base(dst_path), counter)
+		if err == nil {
+			err = tw.Close()
+		}
+		tar_err <- err
+		writer.CloseWithError(err)
+	}()
+
+	err := streamToPod(ctx, executor, dst, reader)
+	reader.Close()
+	if err == nil {
+		err = archiveErr(<-tar_err)
+	}
+	if err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", src, dst, err)
+	}
+
+	return nil
+}
+
+// CopyFiles copies a set of files below the local directory base into the
+// pod directory dst.Path, keeping their relative paths. It is meant for
+// pushing incremental changes rather than whole trees.
+func CopyFiles(ctx context.Context, executor Executor, base string, files []string, dst PodPath, opts CopyOptions) error {
+	counter := &copyCounter{progress: opts.Progress}
+
+	reader, writer := io.Pipe()
+	tar_err := make(chan error, 1)
+	go func() {
+		tw := tar.NewWriter(writer)
+		var err error
+		for _, file := range files {
+			rel, rel_err := filepath.Rel(base, file)
+			if rel_err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				err = fmt.Errorf("%s is not below %s", file, base)
+				break
+			}
+			if err = tarLocalEntry(tw, file, filepath.ToSlash(rel), counter); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		tar_err <- err
+		writer.CloseWithError(err)
+	}()
+
+	// Entries are relative to dst.Path, so extract into it instead of its
+	// parent.
+	err := streamToPodDir(ctx, executor, dst, reader)
+	reader.Close()
+	if err == nil {
+		err = archiveErr(<-tar_err)
+	}
+	if err != nil {
+		return fmt.Errorf("error copying %d files to %s: %w", len(files), dst, err)
+	}
+
+	return nil
+}
+
+// CopyBetweenPods streams src from one pod straight into another without
+// touching the local disk. dst.Path names the copy.
+func CopyBetweenPods(ctx context.Context, executor Executor, src PodPath, dst PodPath, opts CopyOptions) error {
+	src_base := path.Base(path.Clean(src.Path))
+	dst_base := path.Base(path.Clean(dst.Path))
+	counter := &copyCounter{progress: opts.Progress}
+
+	src_reader := streamFromPod(ctx, executor, src)
+	defer src_reader.Close()
+
+	reader, writer := io.Pipe()
+	src_err := make(chan error, 1)
+	go func() {
+		err := retar(tar.NewReader(src_reader), tar.NewWriter(writer), src_base, dst_base, counter)
+		if err == nil {
+			err = drainArchive(src_reader)
+		}
+		src_err <- err
+		writer.CloseWithError(err)
+	}()
+	defer reader.Close()
+
+	// The destination may be done with the archive before the source tar
+	// reports how it ended, so wait for both.
+	err := streamToPod(ctx, executor, dst, reader)
+	if err == nil {
+		err = <-src_err
+	}
+	if err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", src, dst, err)
+	}
+
+	return nil
+}
+
+// archiveErr is the error of the goroutine writing an archive to a pod,
+// once the pod is done with it. client-go drops stdin read errors and tar
+// accepts an archive cut off between entries, so a local file that vanished
+// would otherwise go unnoticed. A pod that stopped reading before the end of
+// archive padding is not a failure.
+func archiveErr(err error) error {
+	if errors.Is(err, io.ErrClosedPipe) {
+		return nil
+	}
+
+	return err
+}
+
+// drainArchive reads what follows the end of an archive from a pod. GNU tar
+// still ends the archive when it skips unreadable files and only exits with
+// status 2 afterwards, which streamFromPod reports as a read error.
+func drainArchive(r io.Reader) error {
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+// streamFromPod runs tar in the pod and returns its output. Remote failures
+// surface as read errors carrying the tar stderr.
+func streamFromPod(ctx context.Context, executor Executor, src PodPath) io.ReadCloser {
+	src_path := path.Clean(src.Path)
+	reader, writer := io.Pipe()
+
+	go func() {
+		errBuf := &bytes.Buffer{}
+		err := executor.Stream(ctx, ExecOptions{
+			Namespace: src.Namespace,
+			Pod:       src.Pod,
+			Container: src.Container,
+			Command:   []string{"tar", "cf", "-", "-C", path.Dir(src_path), path.Base(src_path)},
+			ReadOnly:  true,
+			Stdout:    writer,
+			Stderr:    errBuf,
+		})
+		if err != nil && errBuf.Len() > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(errBuf.String()))
+		}
+		writer.CloseWithError(err)
+	}()
+
+	return reader
+}
+
+// streamToPod extracts the archive read from r into the parent directory of
+// dst.Path, whose entries must be rooted at path.Base(dst.Path).
+func streamToPod(ctx context.Context, executor Executor, dst PodPath, r io.Reader) error {
+	parent := dst
+	parent.Path = path.Dir(path.Clean(dst.Path))
+	return streamToPodDir(ctx, executor, parent, r)
+}
+
+func streamToPodDir(ctx context.Context, executor Executor, dir PodPath, r io.Reader) error {
+	errBuf := &bytes.Buffer{}
+	err := executor.Stream(ctx, ExecOptions{
+		Namespace: dir.Namespace,
+		Pod:       dir.Pod,
+		Container: dir.Container,
+		Command:   []string{"sh", "-c", `mkdir -p "$1" && tar -xpf - -C "$1"`, "sh", path.Clean(dir.Path)},
+		Stdin:     r,
+		Stdout:    io.Discard,
+		Stderr:    errBuf,
+	})
+	if err != nil && errBuf.Len() > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+
+	return err
+}
+
+// tarLocal writes the tree at src to tw, rooting entry names at name.
+func tarLocal(tw *tar.Writer, src string, name string, counter *copyCounter) error {
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+
+		return tarLocalEntry(tw, file, path.Join(name, filepath.ToSlash(rel)), counter)
+	})
+}
+
+func tarLocalEntry(tw *tar.Writer, file string, name string, counter *copyCounter) error {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return err
+	}
+
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(file); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if info.Mode().IsRegular() {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	counter.add(name, hdr.Size)
+	return nil
+}
+
+// retar copies every entry of tr to tw, renaming the src_base root to
+// dst_base.
+func retar(tr *tar.Reader, tw *tar.Writer, src_base string, dst_base string, counter *copyCounter) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return tw.Close()
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := entryRel(hdr.Name, src_base)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(dst_base, rel)
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+
+		counter.add(hdr.Name, hdr.Size)
+	}
+}
+
+// untarLocal extracts entries rooted at base into target, refusing anything
+// that would land outside of it.
+func untarLocal(tr *tar.Reader, base string, target string, counter *copyCounter) error {
+	type dirMeta struct {
+		path string
+		hdr  *tar.Header
+	}
+	var dirs []dirMeta
+
+	root, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := entryRel(hdr.Name, base)
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Join(root, filepath.FromSlash(rel))
+		if rel != "." {
+			if err := checkWithin(root, filepath.Dir(dest)); err != nil {
+				return err
+			}
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := clearDest(dest, true); err != nil {
+				return err
+			}
+			if err := checkWithin(root, dest); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dest, 0o755); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMeta{path: dest, hdr: hdr})
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+			if err := clearDest(dest, false); err != nil {
+				return err
+			}
+			if err := checkWithin(root, dest); err != nil {
+				return err
+			}
+			// O_EXCL fails on anything created at dest since clearDest,
+			// symlinks included.
+			f, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY|openNoFollow, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if err == nil {
+				err = f.Chmod(mode)
+			}
+			if close_err := f.Close(); err == nil {
+				err = close_err
+			}
+			if err != nil {
+				return err
+			}
+			if err := os.Chtimes(dest, hdr.AccessTime, hdr.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+			if err := clearDest(dest, false); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, dest); err != nil {
+				return err
+			}
+		default:
+			// Devices, fifos and hard links have no place in a filestore copy.
+			continue
+		}
+
+		counter.add(path.Join(base, rel), hdr.Size)
+	}
+
+	// Directory permissions go last so read-only directories can be filled.
+	// A later entry may have replaced a directory with a symlink, whose
+	// target must not be touched.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if info, err := os.Lstat(dirs[i].path); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := os.Chmod(dirs[i].path, os.FileMode(dirs[i].hdr.Mode).Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dirs[i].path, dirs[i].hdr.AccessTime, dirs[i].hdr.ModTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clearDest removes what an earlier entry or a previous copy left at dest,
+// so nothing is written through a symlink. An existing directory is kept
+// when dir is set and refused otherwise.
+func clearDest(dest string, dir bool) error {
+	info, err := os.Lstat(dest)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if dir {
+			return nil
+		}
+		return fmt.Errorf("refusing to replace directory %s with a file", dest)
+	}
+
+	return os.Remove(dest)
+}
+
+// entryRel strips the base root from an archive entry name.
+func entryRel(name string, base string) (string, error) {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	if name == base {
+		return ".", nil
+	}
+	if !strings.HasPrefix(name, base+"/") {
+		return "", fmt.Errorf("unexpected archive entry %q outside of %q", name, base)
+	}
+
+	rel := strings.TrimPrefix(name, base+"/")
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("archive entry %q escapes the destination", name)
+	}
+
+	return rel, nil
+}
+
+// checkWithin makes sure dir, once symlinks are resolved, stays below root.
+func checkWithin(root string, dir string) error {
+	resolved_root, err := filepath.EvalSymlinks(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Walk up to the deepest existing ancestor, which is the only part a
+	// symlink could redirect.
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return nil
+		}
+		existing = parent
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(resolved_root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("refusing to write through %s, it resolves outside of %s", dir, root)
+	}
+
+	return nil
+}
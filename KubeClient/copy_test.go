@@ -0,0 +1,163 @@
+package KubeClient_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/v4sr/L0/KubeClient"
+	"github.com/v4sr/L0/KubeClient/fake"
+)
+
+// podArchive builds the tar stream a pod would send for the given entries.
+func podArchive(t *testing.T, entries []tar.Header, contents map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range entries {
+		hdr := hdr
+		body := ""
+		if hdr.Typeflag == tar.TypeReg {
+			body = contents[hdr.Name]
+		}
+		hdr.Size = int64(len(body))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestCopyFromPodDoesNotFollowPlantedSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim.txt")
+	if err := os.WriteFile(victim, []byte("safe"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	victim_dir := filepath.Join(outside, "dir")
+	if err := os.Mkdir(victim_dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := podArchive(t, []tar.Header{
+		{Name: "fs/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "fs/evil", Typeflag: tar.TypeSymlink, Linkname: victim, Mode: 0o777},
+		{Name: "fs/evil", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "fs/d", Typeflag: tar.TypeSymlink, Linkname: victim_dir, Mode: 0o777},
+		{Name: "fs/d/", Typeflag: tar.TypeDir, Mode: 0o700},
+	}, map[string]string{"fs/evil": "pwned"})
+
+	_, exec := fake.NewClient()
+	exec.On("tar cf - -C /var/lib/odoo fs", fake.Response{Stdout: string(archive)})
+
+	dst := filepath.Join(t.TempDir(), "copy")
+	src := KubeClient.PodPath{Namespace: "ns", Pod: "odoo", Path: "/var/lib/odoo/fs"}
+	if err := KubeClient.CopyFromPod(context.Background(), exec, src, dst, KubeClient.CopyOptions{}); err != nil {
+		t.Fatalf("CopyFromPod: %v", err)
+	}
+
+	if data, _ := os.ReadFile(victim); string(data) != "safe" {
+		t.Errorf("file outside the destination was overwritten with %q", data)
+	}
+	if info, err := os.Stat(victim_dir); err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("directory outside the destination was changed: %v %v", info.Mode(), err)
+	}
+
+	info, err := os.Lstat(filepath.Join(dst, "evil"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("fs/evil should be a regular file in the copy: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "evil")); string(data) != "pwned" {
+		t.Errorf("fs/evil has %q", data)
+	}
+}
+
+// failingTar answers tar cf the way GNU tar does when it cannot read some
+// files: a complete archive, then exit status 2.
+func failingTar(t *testing.T, exec *fake.Executor) {
+	t.Helper()
+
+	archive := podArchive(t, []tar.Header{
+		{Name: "fs/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "fs/ok", Typeflag: tar.TypeReg, Mode: 0o644},
+	}, map[string]string{"fs/ok": "ok"})
+
+	exec.On("tar cf - -C /var/lib/odoo fs", fake.Response{
+		Stdout:   string(archive),
+		Stderr:   "tar: fs/secret: Cannot open: Permission denied\ntar: Exiting with failure status due to previous errors",
+		ExitCode: 2,
+	})
+}
+
+func TestCopyFromPodReportsTarFailure(t *testing.T) {
+	_, exec := fake.NewClient()
+	failingTar(t, exec)
+
+	src := KubeClient.PodPath{Namespace: "ns", Pod: "odoo", Path: "/var/lib/odoo/fs"}
+	err := KubeClient.CopyFromPod(context.Background(), exec, src, filepath.Join(t.TempDir(), "copy"), KubeClient.CopyOptions{})
+	if err == nil || !bytes.Contains([]byte(err.Error()), []byte("Permission denied")) {
+		t.Fatalf("CopyFromPod should report the tar failure, got %v", err)
+	}
+}
+
+func TestCopyBetweenPodsReportsTarFailure(t *testing.T) {
+	_, exec := fake.NewClient()
+	failingTar(t, exec)
+	exec.On("sh -c mkdir -p \"$1\" && tar -xpf - -C \"$1\" sh /var/lib/odoo", fake.Response{})
+
+	src := KubeClient.PodPath{Namespace: "ns", Pod: "odoo", Path: "/var/lib/odoo/fs"}
+	dst := KubeClient.PodPath{Namespace: "clone", Pod: "odoo", Path: "/var/lib/odoo/fs"}
+	err := KubeClient.CopyBetweenPods(context.Background(), exec, src, dst, KubeClient.CopyOptions{})
+	if err == nil || !bytes.Contains([]byte(err.Error()), []byte("Permission denied")) {
+		t.Fatalf("CopyBetweenPods should report the tar failure, got %v", err)
+	}
+}
+
+// clientGoStdin answers every exec like client-go does with stdin: read
+// errors are dropped, so only the copy itself can notice a cut archive.
+func clientGoStdin(ctx context.Context, opts KubeClient.ExecOptions) error {
+	io.Copy(io.Discard, opts.Stdin)
+	return nil
+}
+
+func TestCopyFilesReportsVanishedFile(t *testing.T) {
+	base := t.TempDir()
+	for _, name := range []string{"a.py", "c.py"} {
+		if err := os.WriteFile(filepath.Join(base, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []string{filepath.Join(base, "a.py"), filepath.Join(base, "b.py"), filepath.Join(base, "c.py")}
+
+	_, exec := fake.NewClient()
+	exec.Handler = clientGoStdin
+
+	dst := KubeClient.PodPath{Namespace: "ns", Pod: "odoo", Path: "/mnt/extra-addons"}
+	err := KubeClient.CopyFiles(context.Background(), exec, base, files, dst, KubeClient.CopyOptions{})
+	if err == nil || !bytes.Contains([]byte(err.Error()), []byte("b.py")) {
+		t.Fatalf("CopyFiles should report the vanished file, got %v", err)
+	}
+}
+
+func TestCopyToPodReportsVanishedSource(t *testing.T) {
+	_, exec := fake.NewClient()
+	exec.Handler = clientGoStdin
+
+	src := filepath.Join(t.TempDir(), "gone")
+	dst := KubeClient.PodPath{Namespace: "ns", Pod: "odoo", Path: "/var/lib/odoo/gone"}
+	if err := KubeClient.CopyToPod(context.Background(), exec, src, dst, KubeClient.CopyOptions{}); err == nil {
+		t.Fatal("CopyToPod should report the vanished source")
+	}
+}
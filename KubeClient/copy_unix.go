@@ -0,0 +1,8 @@
+//go:build !windows
+
+package KubeClient
+
+import "syscall"
+
+// openNoFollow makes OpenFile fail on a symlink instead of writing through it.
+const openNoFollow = syscall.O_NOFOLLOW
@@ -0,0 +1,7 @@
+//go:build windows
+
+package KubeClient
+
+// openNoFollow is not available on Windows, where untarLocal relies on
+// removing what an earlier entry left and O_EXCL.
+const openNoFollow = 0
@@ -0,0 +1,96 @@
+package KubeClient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DefaultDebugImage is the toolbox used for ephemeral debug containers when
+// none is configured.
+const DefaultDebugImage = "busybox:1.36"
+
+// DebugOptions describes an ephemeral debug container.
+type DebugOptions struct {
+	// Image defaults to DefaultDebugImage.
+	Image string
+	// TargetContainer is the container whose process namespace is shared.
+	TargetContainer string
+	// Timeout bounds the wait for the container to start, 2 minutes when 0.
+	Timeout time.Duration
+}
+
+// AddDebugContainer adds an ephemeral container to pod through the
+// pods/ephemeralcontainers subresource and waits until it runs. It returns
+// the container name, ready to be used with the Executor.
+func (c *Client) AddDebugContainer(ctx context.Context, pod *v1.Pod, opts DebugOptions) (string, error) {
+	image := opts.Image
+	if image == "" {
+		image = DefaultDebugImage
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Minute
+	}
+
+	// This changes the pod spec, so protected namespaces need a confirmation
+	// whatever the caller checked before.
+	if err := c.Guard.Check(ctx, pod.Namespace); err != nil {
+		return "", err
+	}
+
+	// Start from the live pod so the update does not conflict with status
+	// changes made since it was listed.
+	live, err := GetPod(ctx, c.Clientset, pod.Namespace, pod.Name)
+	if err != nil {
+		return "", err
+	}
+
+	name := "debugger-" + utilrand.String(5)
+	updated := live.DeepCopy()
+	updated.Spec.EphemeralContainers = append(updated.Spec.EphemeralContainers, v1.EphemeralContainer{
+		EphemeralContainerCommon: v1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    image,
+			ImagePullPolicy:          v1.PullIfNotPresent,
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: v1.TerminationMessageReadFile,
+		},
+		TargetContainerName: opts.TargetContainer,
+	})
+
+	_, err = c.Clientset.CoreV1().Pods(pod.Namespace).UpdateEphemeralContainers(ctx, pod.Name, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error adding debug container to %s/%s: %w", pod.Namespace, pod.Name, Classify(err))
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		current, err := GetPod(ctx, c.Clientset, pod.Namespace, pod.Name)
+		if err != nil {
+			return false, err
+		}
+
+		for _, status := range current.Status.EphemeralContainerStatuses {
+			if status.Name != name {
+				continue
+			}
+			if status.State.Terminated != nil {
+				return false, fmt.Errorf("debug container %s terminated: %s", name, status.State.Terminated.Reason)
+			}
+			return status.State.Running != nil, nil
+		}
+
+		return false, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error waiting for debug container %s: %w", name, err)
+	}
+
+	return name, nil
+}
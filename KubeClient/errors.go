@@ -0,0 +1,121 @@
+package KubeClient
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Sentinel errors returned by the lookup helpers, to be tested with
+// errors.Is.
+var (
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrNodeNotFound      = errors.New("node not found")
+	ErrPodNotFound       = errors.New("pod not found")
+	ErrContainerNotFound = errors.New("container not found")
+	ErrForbidden         = errors.New("forbidden")
+	ErrUnreachable       = errors.New("cluster unreachable")
+)
+
+// Exit codes shared by every tool so scripts can tell failures apart. Remote
+// command failures exit with the remote status instead, so the lookup
+// failures sit at 80 and up, a range shells and common tools leave alone.
+const (
+	ExitFailure     = 1
+	ExitUsage       = 2
+	ExitNotFound    = 80
+	ExitForbidden   = 81
+	ExitUnreachable = 82
+)
+
+// ExitCode maps err to the process exit code a tool should return.
+func ExitCode(err error) int {
+	var exit_err *ExitError
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exit_err):
+		return exit_err.Code
+	case errors.Is(err, ErrNamespaceNotFound), errors.Is(err, ErrNodeNotFound),
+		errors.Is(err, ErrPodNotFound), errors.Is(err, ErrContainerNotFound):
+		return ExitNotFound
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrProtected):
+		return ExitForbidden
+	case errors.Is(err, ErrUnreachable):
+		return ExitUnreachable
+	default:
+		return ExitFailure
+	}
+}
+
+// Classify wraps API errors that are about permissions or connectivity into
+// ErrForbidden or ErrUnreachable. Other errors are returned unchanged.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var net_err net.Error
+	var cert_err x509.UnknownAuthorityError
+	var host_err x509.HostnameError
+
+	switch {
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrUnreachable):
+		return err
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return fmt.Errorf("%w: %w", ErrForbidden, err)
+	case apierrors.IsServiceUnavailable(err), apierrors.IsTimeout(err), apierrors.IsServerTimeout(err),
+		errors.Is(err, context.DeadlineExceeded), errors.As(err, &net_err),
+		errors.As(err, &cert_err), errors.As(err, &host_err):
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	default:
+		return err
+	}
+}
+
+func lookupError(err error, not_found error, name string) error {
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", not_found, name)
+	}
+
+	return Classify(err)
+}
+
+// GetNamespace fetches a namespace, returning ErrNamespaceNotFound when it
+// does not exist.
+func GetNamespace(ctx context.Context, clientset kubernetes.Interface, name string) (*v1.Namespace, error) {
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, lookupError(err, ErrNamespaceNotFound, name)
+	}
+
+	return ns, nil
+}
+
+// GetNode fetches a node, returning ErrNodeNotFound when it does not exist.
+func GetNode(ctx context.Context, clientset kubernetes.Interface, name string) (*v1.Node, error) {
+	node, err := clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, lookupError(err, ErrNodeNotFound, name)
+	}
+
+	return node, nil
+}
+
+// GetPod fetches a pod, returning ErrPodNotFound when it does not exist.
+func GetPod(ctx context.Context, clientset kubernetes.Interface, namespace string, name string) (*v1.Pod, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, lookupError(err, ErrPodNotFound, namespace+"/"+name)
+	}
+
+	return pod, nil
+}
@@ -0,0 +1,36 @@
+package KubeClient_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{fmt.Errorf("%w: odoo-0", KubeClient.ErrPodNotFound), KubeClient.ExitNotFound},
+		{fmt.Errorf("%w: nope", KubeClient.ErrForbidden), KubeClient.ExitForbidden},
+		{KubeClient.ErrProtected, KubeClient.ExitForbidden},
+		{fmt.Errorf("%w: dial tcp", KubeClient.ErrUnreachable), KubeClient.ExitUnreachable},
+		{fmt.Errorf("boom"), KubeClient.ExitFailure},
+		{&KubeClient.ExitError{Code: 3}, 3},
+	}
+	for _, test := range tests {
+		if got := KubeClient.ExitCode(test.err); got != test.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+
+	// A remote command can exit with anything up to 255, the lookup codes
+	// must stay clear of the ones shells and everyday tools use.
+	for _, code := range []int{KubeClient.ExitNotFound, KubeClient.ExitForbidden, KubeClient.ExitUnreachable} {
+		if code <= 5 || code >= 126 {
+			t.Errorf("lookup exit code %d clashes with common remote statuses", code)
+		}
+	}
+}
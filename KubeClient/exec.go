@@ -0,0 +1,132 @@
+package KubeClient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// ExecOptions describes a command run inside a pod container. Nil streams are
+// not requested from the API server; an empty Container lets it pick the
+// default one.
+type ExecOptions struct {
+	Namespace string
+	Pod       string
+	Container string
+	Command   []string
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+	TTY       bool
+	// TerminalSizeQueue feeds window resizes to the remote TTY.
+	TerminalSizeQueue remotecommand.TerminalSizeQueue
+	// ReadOnly marks commands that only read from the container, such as
+	// the source side of a copy. The protected namespace guard lets them
+	// through without asking.
+	ReadOnly bool
+}
+
+// ExitError reports a remote command that ran but exited with a non-zero
+// status.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command terminated with exit code %d", e.Code)
+}
+
+// Executor runs commands in pods through the exec subresource. The fake
+// package provides an in-memory implementation for tests.
+//
+// Stream blocks until the remote command ends or ctx is cancelled. A
+// non-zero remote exit status is returned as an *ExitError.
+type Executor interface {
+	Stream(ctx context.Context, opts ExecOptions) error
+}
+
+type remoteExecutor struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+// NewExecutor returns an Executor that speaks the WebSocket exec protocol
+// and falls back to SPDY when the API server cannot upgrade to it.
+func NewExecutor(config *rest.Config, clientset kubernetes.Interface) Executor {
+	return &remoteExecutor{config: config, clientset: clientset}
+}
+
+func (e *remoteExecutor) Stream(ctx context.Context, opts ExecOptions) error {
+	req := e.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(opts.Pod).
+		Namespace(opts.Namespace).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: opts.Container,
+			Command:   opts.Command,
+			Stdin:     opts.Stdin != nil,
+			Stdout:    opts.Stdout != nil,
+			Stderr:    opts.Stderr != nil && !opts.TTY,
+			TTY:       opts.TTY,
+		}, scheme.ParameterCodec)
+
+	ws_exec, err := remotecommand.NewWebSocketExecutor(e.config, "GET", req.URL().String())
+	if err != nil {
+		return fmt.Errorf("failed to create websocket executor: %w", err)
+	}
+
+	spdy_exec, err := remotecommand.NewSPDYExecutor(e.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create SPDY executor: %w", err)
+	}
+
+	exec, err := remotecommand.NewFallbackExecutor(ws_exec, spdy_exec, httpstream.IsUpgradeFailure)
+	if err != nil {
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:             opts.Stdin,
+		Stdout:            opts.Stdout,
+		Stderr:            opts.Stderr,
+		Tty:               opts.TTY,
+		TerminalSizeQueue: opts.TerminalSizeQueue,
+	})
+	if err != nil {
+		var code_err utilexec.ExitError
+		if errors.As(err, &code_err) && code_err.Exited() {
+			return &ExitError{Code: code_err.ExitStatus()}
+		}
+
+		return fmt.Errorf("failed executing %q in %s/%s: %w", strings.Join(opts.Command, " "), opts.Namespace, opts.Pod, err)
+	}
+
+	return nil
+}
+
+// Run executes opts.Command and returns its captured stdout and stderr.
+// Stdout, Stderr and TTY in opts are ignored. The output is returned even
+// when the command exits non-zero.
+func Run(ctx context.Context, executor Executor, opts ExecOptions) (string, string, error) {
+	buf := &bytes.Buffer{}
+	errBuf := &bytes.Buffer{}
+
+	opts.Stdout = buf
+	opts.Stderr = errBuf
+	opts.TTY = false
+	err := executor.Stream(ctx, opts)
+
+	return buf.String(), errBuf.String(), err
+}
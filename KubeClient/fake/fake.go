@@ -0,0 +1,97 @@
+// Package fake provides in-memory stand-ins for KubeClient so the tools can
+// be unit tested without a cluster.
+package fake
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// NewClient returns a KubeClient.Client backed by a fake clientset seeded
+// with objects, together with the fake Executor it uses.
+func NewClient(objects ...runtime.Object) (*KubeClient.Client, *Executor) {
+	exec := &Executor{}
+	return &KubeClient.Client{
+		Config:    &rest.Config{Host: "https://fake.invalid"},
+		Clientset: fakeclientset.NewSimpleClientset(objects...),
+		Executor:  exec,
+		Namespace: "default",
+		Context:   "fake",
+	}, exec
+}
+
+// Response is what the fake Executor answers to a command. A non-zero
+// ExitCode is reported as a *KubeClient.ExitError unless Err is set.
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Err      error
+}
+
+// Executor records every exec call and replies with the Response registered
+// for the command, or with Handler when no response matches.
+type Executor struct {
+	mu        sync.Mutex
+	Calls     []KubeClient.ExecOptions
+	Responses map[string]Response
+	Handler   func(ctx context.Context, opts KubeClient.ExecOptions) error
+}
+
+// On registers the response for a command, given as its arguments joined by
+// single spaces.
+func (e *Executor) On(command string, resp Response) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.Responses == nil {
+		e.Responses = make(map[string]Response)
+	}
+	e.Responses[command] = resp
+}
+
+func (e *Executor) Stream(ctx context.Context, opts KubeClient.ExecOptions) error {
+	e.mu.Lock()
+	e.Calls = append(e.Calls, opts)
+	resp, found := e.Responses[strings.Join(opts.Command, " ")]
+	handler := e.Handler
+	e.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !found && handler != nil {
+		return handler(ctx, opts)
+	}
+
+	if opts.Stdin != nil {
+		if _, err := io.Copy(io.Discard, opts.Stdin); err != nil {
+			return err
+		}
+	}
+	if opts.Stdout != nil {
+		if _, err := io.WriteString(opts.Stdout, resp.Stdout); err != nil {
+			return err
+		}
+	}
+	if opts.Stderr != nil {
+		if _, err := io.WriteString(opts.Stderr, resp.Stderr); err != nil {
+			return err
+		}
+	}
+
+	if resp.Err == nil && resp.ExitCode != 0 {
+		return &KubeClient.ExitError{Code: resp.ExitCode}
+	}
+
+	return resp.Err
+}
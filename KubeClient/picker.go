@@ -0,0 +1,370 @@
+package KubeClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+var (
+	// ErrNoTerminal is returned by Picker.Run when there is no terminal to
+	// ask on; callers should ask for a flag instead.
+	ErrNoTerminal = errors.New("interactive selection needs a terminal")
+	// ErrPickCancelled is returned when the user leaves the picker with
+	// Esc or Ctrl-C. It wraps context.Canceled so tools exit as on Ctrl-C.
+	ErrPickCancelled = fmt.Errorf("selection cancelled: %w", context.Canceled)
+)
+
+// pickerMaxRows caps the list height on tall terminals.
+const pickerMaxRows = 15
+
+// PickerItem is one selectable row.
+type PickerItem struct {
+	Name    string
+	Columns []string
+}
+
+// Picker is a terminal list with incremental filtering. Typing narrows the
+// rows down to those containing every word typed, arrows, Ctrl-P/Ctrl-N and
+// PgUp/PgDn move, Enter selects and Esc or Ctrl-C cancels.
+type Picker struct {
+	Prompt string
+	// Header names the columns, NAME included.
+	Header []string
+	Items  []PickerItem
+	// TTY defaults to stdin, drawing on stderr so stdout stays usable in
+	// pipes.
+	TTY TTY
+}
+
+type pickerState struct {
+	Picker
+	filter   []rune
+	matches  []int
+	cursor   int
+	offset   int
+	widths   []int
+	haystack []string
+}
+
+// Run shows the picker and returns the index in Items of the selected row.
+func (p Picker) Run() (int, error) {
+	if p.TTY.In == nil {
+		p.TTY = TTY{In: os.Stdin, Out: os.Stderr}
+	}
+	if !p.TTY.IsTerminal() {
+		return -1, ErrNoTerminal
+	}
+	if len(p.Items) == 0 {
+		return -1, errors.New("nothing to select from")
+	}
+
+	state, err := term.MakeRaw(int(p.TTY.In.Fd()))
+	if err != nil {
+		return -1, fmt.Errorf("error putting terminal in raw mode: %w", err)
+	}
+	defer term.Restore(int(p.TTY.In.Fd()), state)
+
+	s := &pickerState{Picker: p}
+	s.prepare()
+	s.render()
+
+	buf := make([]byte, 64)
+	for {
+		n, err := p.TTY.In.Read(buf)
+		if err != nil {
+			s.erase()
+			return -1, fmt.Errorf("error reading from terminal: %w", err)
+		}
+
+		keys := buf[:n]
+		for i := 0; i < len(keys); i++ {
+			switch b := keys[i]; {
+			case b == 3, b == 27 && i+1 == len(keys):
+				s.erase()
+				return -1, ErrPickCancelled
+			case b == 27 && i+2 < len(keys) && (keys[i+1] == '[' || keys[i+1] == 'O'):
+				i += 2
+				switch keys[i] {
+				case 'A':
+					s.move(-1)
+				case 'B':
+					s.move(1)
+				case 'H':
+					s.move(-len(s.Items))
+				case 'F':
+					s.move(len(s.Items))
+				case '5', '6':
+					if keys[i] == '5' {
+						s.move(-pickerMaxRows)
+					} else {
+						s.move(pickerMaxRows)
+					}
+					if i+1 < len(keys) && keys[i+1] == '~' {
+						i++
+					}
+				}
+			case b == '\r', b == '\n':
+				if len(s.matches) > 0 {
+					s.erase()
+					return s.matches[s.cursor], nil
+				}
+			case b == 16:
+				s.move(-1)
+			case b == 14:
+				s.move(1)
+			case b == 127, b == 8:
+				if len(s.filter) > 0 {
+					s.filter = s.filter[:len(s.filter)-1]
+					s.refilter()
+				}
+			case b == 21:
+				s.filter = nil
+				s.refilter()
+			case b >= 32:
+				r, size := utf8.DecodeRune(keys[i:])
+				i += size - 1
+				s.filter = append(s.filter, r)
+				s.refilter()
+			}
+		}
+
+		s.render()
+	}
+}
+
+func (s *pickerState) prepare() {
+	s.widths = make([]int, len(s.Header))
+	for i, title := range s.Header {
+		s.widths[i] = utf8.RuneCountInString(title)
+	}
+
+	for _, item := range s.Items {
+		cells := append([]string{item.Name}, item.Columns...)
+		for i, cell := range cells {
+			if i >= len(s.widths) {
+				s.widths = append(s.widths, 0)
+			}
+			s.widths[i] = max(s.widths[i], utf8.RuneCountInString(cell))
+		}
+		s.haystack = append(s.haystack, strings.ToLower(strings.Join(cells, " ")))
+	}
+
+	s.refilter()
+}
+
+func (s *pickerState) refilter() {
+	words := strings.Fields(strings.ToLower(string(s.filter)))
+
+	s.matches = s.matches[:0]
+	for i, text := range s.haystack {
+		found := true
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				found = false
+				break
+			}
+		}
+		if found {
+			s.matches = append(s.matches, i)
+		}
+	}
+
+	s.cursor = 0
+	s.offset = 0
+}
+
+func (s *pickerState) move(delta int) {
+	s.cursor = min(max(s.cursor+delta, 0), max(len(s.matches)-1, 0))
+}
+
+func (s *pickerState) row(cells []string, width int) string {
+	var line strings.Builder
+	for i, cell := range cells {
+		line.WriteString(cell)
+		if i < len(cells)-1 {
+			line.WriteString(strings.Repeat(" ", s.widths[i]-utf8.RuneCountInString(cell)+2))
+		}
+	}
+
+	text := line.String()
+	width = max(width, 1)
+	if utf8.RuneCountInString(text) > width {
+		text = string([]rune(text)[:width])
+	}
+	return text
+}
+
+func (s *pickerState) render() {
+	// Some ptys report 0x0 until their first resize.
+	width, height, err := term.GetSize(int(s.TTY.Out.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	if err != nil || height <= 0 {
+		height = 24
+	}
+	rows := min(max(height-3, 1), pickerMaxRows)
+
+	if s.cursor < s.offset {
+		s.offset = s.cursor
+	}
+	if s.cursor >= s.offset+rows {
+		s.offset = s.cursor - rows + 1
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s (%d/%d): %s", s.Prompt, len(s.matches), len(s.Items), string(s.filter)),
+		"  " + s.row(s.Header, width-3),
+	}
+	for i := s.offset; i < len(s.matches) && i < s.offset+rows; i++ {
+		item := s.Items[s.matches[i]]
+		text := s.row(append([]string{item.Name}, item.Columns...), width-3)
+		if i == s.cursor {
+			text = "> \x1b[7m" + text + "\x1b[0m"
+		} else {
+			text = "  " + text
+		}
+		lines = append(lines, text)
+	}
+
+	var out strings.Builder
+	s.clear(&out)
+	out.WriteString(strings.Join(lines, "\r\n"))
+	// Leave the cursor after the filter text on the prompt line.
+	if len(lines) > 1 {
+		fmt.Fprintf(&out, "\x1b[%dA", len(lines)-1)
+	}
+	fmt.Fprintf(&out, "\r\x1b[%dC", utf8.RuneCountInString(lines[0]))
+
+	s.TTY.Out.WriteString(out.String())
+}
+
+// clear moves back to the prompt line and erases what was drawn below it.
+func (s *pickerState) clear(out *strings.Builder) {
+	out.WriteString("\r\x1b[J")
+}
+
+func (s *pickerState) erase() {
+	var out strings.Builder
+	s.clear(&out)
+	s.TTY.Out.WriteString(out.String())
+}
+
+// Age formats the time elapsed since t like kubectl does.
+func Age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+
+	return duration.HumanDuration(time.Since(t.Time))
+}
+
+// PodStatus is the one-word status kubectl get pods shows.
+func PodStatus(pod *v1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+
+	for i, status := range pod.Status.InitContainerStatuses {
+		switch {
+		case status.State.Terminated != nil && status.State.Terminated.ExitCode == 0:
+			continue
+		case status.State.Waiting != nil && status.State.Waiting.Reason != "" && status.State.Waiting.Reason != "PodInitializing":
+			return "Init:" + status.State.Waiting.Reason
+		default:
+			return fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers))
+		}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return status.State.Waiting.Reason
+		}
+		if status.State.Terminated != nil && status.State.Terminated.Reason != "" {
+			return status.State.Terminated.Reason
+		}
+	}
+
+	if pod.Status.Reason != "" {
+		return pod.Status.Reason
+	}
+	return string(pod.Status.Phase)
+}
+
+// PodItem describes pod with the READY, STATUS, RESTARTS, AGE and NODE
+// columns of PodHeader.
+func PodItem(pod *v1.Pod) PickerItem {
+	ready, restarts := 0, int32(0)
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready {
+			ready++
+		}
+		restarts += status.RestartCount
+	}
+
+	return PickerItem{
+		Name: pod.Name,
+		Columns: []string{
+			fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers)),
+			PodStatus(pod),
+			strconv.Itoa(int(restarts)),
+			Age(pod.CreationTimestamp),
+			pod.Spec.NodeName,
+		},
+	}
+}
+
+// PodHeader titles the columns of PodItem.
+var PodHeader = []string{"NAME", "READY", "STATUS", "RESTARTS", "AGE", "NODE"}
+
+// PickPod lets the user choose one of pods.
+func PickPod(prompt string, pods []v1.Pod) (*v1.Pod, error) {
+	items := make([]PickerItem, len(pods))
+	for i := range pods {
+		items[i] = PodItem(&pods[i])
+	}
+
+	i, err := Picker{Prompt: prompt, Header: PodHeader, Items: items}.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pods[i], nil
+}
+
+// NamespaceHeader titles the columns of NamespaceItem.
+var NamespaceHeader = []string{"NAME", "STATUS", "AGE"}
+
+// NamespaceItem describes namespace with the columns of NamespaceHeader.
+func NamespaceItem(namespace *v1.Namespace) PickerItem {
+	return PickerItem{
+		Name:    namespace.Name,
+		Columns: []string{string(namespace.Status.Phase), Age(namespace.CreationTimestamp)},
+	}
+}
+
+// PickNamespace lets the user choose one of namespaces.
+func PickNamespace(prompt string, namespaces []v1.Namespace) (string, error) {
+	items := make([]PickerItem, len(namespaces))
+	for i := range namespaces {
+		items[i] = NamespaceItem(&namespaces[i])
+	}
+
+	i, err := Picker{Prompt: prompt, Header: NamespaceHeader, Items: items}.Run()
+	if err != nil {
+		return "", err
+	}
+
+	return namespaces[i].Name, nil
+}
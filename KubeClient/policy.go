@@ -0,0 +1,247 @@
+package KubeClient
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// PolicyEnv points to the policy file when Options leaves it unset.
+const PolicyEnv = "KUBECLIENT_POLICY"
+
+// ErrProtected is returned for commands in a protected namespace that were
+// not confirmed.
+var ErrProtected = errors.New("protected namespace")
+
+// Policy lists the namespaces that need a typed confirmation before a tool
+// runs anything in them:
+//
+//	protected:
+//	  namespaces: ["prod-*", "erp"]
+//	  labels: ["env=production"]
+type Policy struct {
+	Protected struct {
+		// Namespaces are glob patterns matched against the namespace name.
+		Namespaces []string `json:"namespaces"`
+		// Labels are label selectors matched against the namespace labels.
+		Labels []string `json:"labels"`
+	} `json:"protected"`
+
+	selectors []labels.Selector
+}
+
+// DefaultPolicyPath is policy.yaml in the kubeclient user config directory.
+func DefaultPolicyPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating the policy file: %w", err)
+	}
+
+	return filepath.Join(dir, "kubeclient", "policy.yaml"), nil
+}
+
+// LoadPolicy reads the policy at path, nil when the file does not exist.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy: %w", err)
+	}
+
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+
+	for _, pattern := range policy.Protected.Namespaces {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %q in %s: %w", pattern, path, err)
+		}
+	}
+	for _, selector := range policy.Protected.Labels {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector %q in %s: %w", selector, path, err)
+		}
+		policy.selectors = append(policy.selectors, parsed)
+	}
+
+	return policy, nil
+}
+
+// Protects reports whether the namespace is protected, and by which rule.
+func (p *Policy) Protects(ctx context.Context, clientset kubernetes.Interface, namespace string) (bool, string, error) {
+	if p == nil {
+		return false, "", nil
+	}
+
+	for _, pattern := range p.Protected.Namespaces {
+		if matched, _ := filepath.Match(pattern, namespace); matched {
+			return true, "name matches " + pattern, nil
+		}
+	}
+	if len(p.selectors) == 0 {
+		return false, "", nil
+	}
+
+	ns, err := GetNamespace(ctx, clientset, namespace)
+	if err != nil {
+		return false, "", fmt.Errorf("cannot check the labels of namespace %s against the protected policy: %w", namespace, err)
+	}
+	for i, selector := range p.selectors {
+		if selector.Matches(labels.Set(ns.Labels)) {
+			return true, "labels match " + p.Protected.Labels[i], nil
+		}
+	}
+
+	return false, "", nil
+}
+
+// Guard asks for a typed confirmation the first time a process works in a
+// protected namespace. With Override set it lets everything through and
+// records that in the audit log instead.
+type Guard struct {
+	Policy    *Policy
+	Clientset kubernetes.Interface
+	Override  bool
+	Audit     *AuditLog
+	// Confirm asks the user to confirm namespace, by default by typing its
+	// name on the terminal.
+	Confirm func(namespace string, reason string) bool
+
+	mu      sync.Mutex
+	decided map[string]error
+}
+
+// newGuard loads the policy described by opts, nil when there is none.
+func newGuard(opts Options, client *Client) (*Guard, error) {
+	path := opts.Policy
+	if path == "" {
+		path = os.Getenv(PolicyEnv)
+	}
+	if path == "" {
+		var err error
+		if path, err = DefaultPolicyPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	policy, err := LoadPolicy(path)
+	if err != nil || policy == nil {
+		return nil, err
+	}
+
+	return &Guard{
+		Policy:    policy,
+		Clientset: client.Clientset,
+		Override:  opts.OverrideProtected,
+		Audit:     client.Audit,
+		Confirm:   confirmOnTerminal,
+	}, nil
+}
+
+// Check returns nil when work in namespace may go on. Prompts are
+// serialized and each namespace is only asked for once.
+func (g *Guard) Check(ctx context.Context, namespace string) error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err, found := g.decided[namespace]; found {
+		return err
+	}
+
+	err := g.decide(ctx, namespace)
+	if g.decided == nil {
+		g.decided = map[string]error{}
+	}
+	g.decided[namespace] = err
+
+	return err
+}
+
+func (g *Guard) decide(ctx context.Context, namespace string) error {
+	protected, reason, err := g.Policy.Protects(ctx, g.Clientset, namespace)
+	if err != nil || !protected {
+		return err
+	}
+
+	entry := AuditEntry{Namespace: namespace, Details: map[string]string{"rule": reason}}
+	switch {
+	case g.Override:
+		entry.Action = "protected-override"
+		fmt.Fprintf(os.Stderr, "Namespace %s is protected (%s), going on because of --override-protected\n", namespace, reason)
+	case g.Confirm(namespace, reason):
+		entry.Action = "protected-confirm"
+	default:
+		entry.Action = "protected-deny"
+		entry.ExitCode = -1
+		err = fmt.Errorf("%w: %s (%s) was not confirmed", ErrProtected, namespace, reason)
+		entry.Error = err.Error()
+	}
+	g.Audit.Record(entry)
+
+	return err
+}
+
+// confirmOnTerminal makes the user type the namespace name on the
+// controlling terminal, so piped stdin cannot confirm by accident.
+func confirmOnTerminal(namespace string, reason string) bool {
+	in, out, err := openTerminal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Namespace %s is protected (%s) and there is no terminal to confirm on\n", namespace, reason)
+		return false
+	}
+	defer in.Close()
+	if out != in {
+		defer out.Close()
+	}
+
+	fmt.Fprintf(out, "Namespace %s is protected (%s).\nType the namespace name to go on: ", namespace, reason)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(out)
+		return false
+	}
+
+	return strings.TrimSpace(answer) == namespace
+}
+
+// Executor wraps executor so commands in protected namespaces need a
+// confirmation. Read-only commands go through unasked.
+func (g *Guard) Executor(executor Executor) Executor {
+	if g == nil {
+		return executor
+	}
+
+	return &guardedExecutor{executor: executor, guard: g}
+}
+
+type guardedExecutor struct {
+	executor Executor
+	guard    *Guard
+}
+
+func (e *guardedExecutor) Stream(ctx context.Context, opts ExecOptions) error {
+	if !opts.ReadOnly {
+		if err := e.guard.Check(ctx, opts.Namespace); err != nil {
+			return err
+		}
+	}
+
+	return e.executor.Stream(ctx, opts)
+}
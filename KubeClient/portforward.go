@@ -0,0 +1,117 @@
+package KubeClient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// ForwardOptions describes a port-forward to a pod.
+type ForwardOptions struct {
+	Namespace string
+	Pod       string
+	// Ports use the kubectl syntax: "8069", "18069:8069", or ":5432" for a
+	// random local port.
+	Ports []string
+	// Addresses to listen on, localhost when empty.
+	Addresses []string
+	// Ready, when set, receives the bound ports once every listener is up.
+	Ready chan<- []ForwardedPort
+	// Out and ErrOut receive the forwarder's connection messages.
+	Out    io.Writer
+	ErrOut io.Writer
+}
+
+// ForwardedPort is a local port bound to a pod port.
+type ForwardedPort struct {
+	Local  uint16
+	Remote uint16
+}
+
+// PortForward forwards opts.Ports to the pod until ctx is cancelled or the
+// connection to the API server is lost. It tunnels SPDY over WebSocket and
+// falls back to plain SPDY on API servers that cannot upgrade.
+func (c *Client) PortForward(ctx context.Context, opts ForwardOptions) error {
+	req := c.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(opts.Namespace).
+		Name(opts.Pod).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.Config)
+	if err != nil {
+		return fmt.Errorf("failed to create port-forward transport: %w", err)
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+
+	tunnel_dialer, err := portforward.NewSPDYOverWebsocketDialer(req.URL(), c.Config)
+	if err != nil {
+		return fmt.Errorf("failed to create port-forward websocket dialer: %w", err)
+	}
+	dialer = portforward.NewFallbackDialer(tunnel_dialer, dialer, httpstream.IsUpgradeFailure)
+
+	addresses := opts.Addresses
+	if len(addresses) == 0 {
+		addresses = []string{"localhost"}
+	}
+	out, errOut := opts.Out, opts.ErrOut
+	if out == nil {
+		out = io.Discard
+	}
+	if errOut == nil {
+		errOut = io.Discard
+	}
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, addresses, opts.Ports, stop, ready, out, errOut)
+	if err != nil {
+		return fmt.Errorf("invalid port-forward to %s/%s: %w", opts.Namespace, opts.Pod, err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(stop)
+		case <-done:
+		}
+	}()
+
+	go func() {
+		select {
+		case <-ready:
+		case <-done:
+			return
+		}
+		if opts.Ready == nil {
+			return
+		}
+
+		ports, err := fw.GetPorts()
+		if err != nil {
+			return
+		}
+		bound := make([]ForwardedPort, 0, len(ports))
+		for _, port := range ports {
+			bound = append(bound, ForwardedPort{Local: port.Local, Remote: port.Remote})
+		}
+
+		select {
+		case opts.Ready <- bound:
+		case <-done:
+		}
+	}()
+
+	if err := fw.ForwardPorts(); err != nil {
+		return fmt.Errorf("port-forward to %s/%s failed: %w", opts.Namespace, opts.Pod, err)
+	}
+
+	return nil
+}
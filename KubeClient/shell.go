@@ -0,0 +1,62 @@
+package KubeClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoShell is returned by DetectShell when a container has none of Shells,
+// as in distroless images.
+var ErrNoShell = errors.New("no shell found in container")
+
+// Shells are probed by DetectShell in order of preference.
+var Shells = []string{"/bin/bash", "/bin/sh"}
+
+// DetectShell returns the first of Shells that runs in the container
+// addressed by target's Namespace, Pod and Container.
+func DetectShell(ctx context.Context, executor Executor, target ExecOptions) (string, error) {
+	for _, shell := range Shells {
+		probe := ExecOptions{
+			Namespace: target.Namespace,
+			Pod:       target.Pod,
+			Container: target.Container,
+			Command:   []string{shell, "-c", "exit 0"},
+		}
+
+		_, stderr, err := Run(ctx, executor, probe)
+		if err == nil {
+			return shell, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		// Anything but a missing binary, such as a container that is not
+		// running, is not a reason to look for a debug container.
+		if !shellMissing(err, stderr) {
+			return "", Classify(err)
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s/%s %s", ErrNoShell, target.Namespace, target.Pod, target.Container)
+}
+
+// shellMissing reports whether a probe failed because the shell binary is
+// not in the image: the shell exit codes for a command that cannot be run,
+// or the container runtime refusing to start it.
+func shellMissing(err error, stderr string) bool {
+	var exit_err *ExitError
+	if errors.As(err, &exit_err) {
+		return exit_err.Code == 126 || exit_err.Code == 127
+	}
+
+	for _, message := range []string{err.Error(), stderr} {
+		if strings.Contains(message, "executable file not found") || strings.Contains(message, "no such file or directory") {
+			return true
+		}
+	}
+
+	return false
+}
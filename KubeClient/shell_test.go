@@ -0,0 +1,36 @@
+package KubeClient_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/v4sr/L0/KubeClient"
+	"github.com/v4sr/L0/KubeClient/fake"
+)
+
+func TestDetectShellFallsBackOnMissingBinary(t *testing.T) {
+	_, exec := fake.NewClient()
+	exec.On("/bin/bash -c exit 0", fake.Response{ExitCode: 127})
+	exec.On("/bin/sh -c exit 0", fake.Response{})
+
+	shell, err := KubeClient.DetectShell(context.Background(), exec, KubeClient.ExecOptions{Namespace: "ns", Pod: "odoo"})
+	if err != nil || shell != "/bin/sh" {
+		t.Fatalf("DetectShell = %q, %v, want /bin/sh", shell, err)
+	}
+}
+
+func TestDetectShellKeepsOtherErrors(t *testing.T) {
+	not_running := errors.New(`unable to upgrade connection: container not found ("odoo")`)
+
+	_, exec := fake.NewClient()
+	exec.On("/bin/bash -c exit 0", fake.Response{Err: not_running})
+
+	_, err := KubeClient.DetectShell(context.Background(), exec, KubeClient.ExecOptions{Namespace: "ns", Pod: "odoo"})
+	if !errors.Is(err, not_running) || errors.Is(err, KubeClient.ErrNoShell) {
+		t.Fatalf("DetectShell should return the exec error, got %v", err)
+	}
+	if len(exec.Calls) != 1 {
+		t.Errorf("DetectShell probed %d shells after the exec was rejected", len(exec.Calls))
+	}
+}
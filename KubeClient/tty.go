@@ -0,0 +1,107 @@
+package KubeClient
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"golang.org/x/term"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// TTY wraps the local terminal used by an interactive exec session.
+type TTY struct {
+	In  *os.File
+	Out *os.File
+}
+
+// IsTerminal reports whether both ends of the TTY are terminals.
+func (t TTY) IsTerminal() bool {
+	return t.In != nil && t.Out != nil && term.IsTerminal(int(t.In.Fd())) && term.IsTerminal(int(t.Out.Fd()))
+}
+
+// Size returns the current size of the output terminal, nil when unknown.
+func (t TTY) Size() *remotecommand.TerminalSize {
+	width, height, err := term.GetSize(int(t.Out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return nil
+	}
+
+	return &remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+}
+
+// Safe puts In in raw mode, runs fn with a queue of window size changes and
+// restores the terminal afterwards, also when fn panics or the process is
+// told to terminate.
+func (t TTY) Safe(fn func(sizes remotecommand.TerminalSizeQueue) error) error {
+	state, err := term.MakeRaw(int(t.In.Fd()))
+	if err != nil {
+		return fmt.Errorf("error putting terminal in raw mode: %w", err)
+	}
+
+	var once sync.Once
+	restore := func() {
+		once.Do(func() { term.Restore(int(t.In.Fd()), state) })
+	}
+	defer restore()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case sig := <-signals:
+			restore()
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		case <-done:
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			restore()
+			panic(r)
+		}
+	}()
+
+	queue := &sizeQueue{sizes: make(chan remotecommand.TerminalSize, 1), done: done}
+	go watchSize(t, queue)
+
+	return fn(queue)
+}
+
+type sizeQueue struct {
+	sizes chan remotecommand.TerminalSize
+	done  chan struct{}
+}
+
+func (q *sizeQueue) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-q.sizes:
+		return &size
+	case <-q.done:
+		return nil
+	}
+}
+
+// push replaces any pending size with the latest one.
+func (q *sizeQueue) push(size *remotecommand.TerminalSize) {
+	if size == nil {
+		return
+	}
+
+	select {
+	case <-q.sizes:
+	default:
+	}
+
+	select {
+	case q.sizes <- *size:
+	case <-q.done:
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package KubeClient
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchSize pushes the initial size and every SIGWINCH driven change.
+func watchSize(t TTY, queue *sizeQueue) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+
+	queue.push(t.Size())
+	for {
+		select {
+		case <-winch:
+			queue.push(t.Size())
+		case <-queue.done:
+			return
+		}
+	}
+}
+
+// openTerminal opens the controlling terminal, also when stdin is a pipe.
+func openTerminal() (*os.File, *os.File, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tty, tty, nil
+}
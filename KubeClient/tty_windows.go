@@ -0,0 +1,43 @@
+//go:build windows
+
+package KubeClient
+
+import (
+	"os"
+	"time"
+)
+
+// watchSize polls the console size, Windows has no SIGWINCH.
+func watchSize(t TTY, queue *sizeQueue) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	last := t.Size()
+	queue.push(last)
+	for {
+		select {
+		case <-ticker.C:
+			if size := t.Size(); size != nil && (last == nil || *size != *last) {
+				last = size
+				queue.push(size)
+			}
+		case <-queue.done:
+			return
+		}
+	}
+}
+
+// openTerminal opens the console, also when stdin is a pipe.
+func openTerminal() (*os.File, *os.File, error) {
+	in, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := os.OpenFile("CONOUT$", os.O_RDWR, 0)
+	if err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+
+	return in, out, nil
+}
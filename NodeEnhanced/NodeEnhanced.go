@@ -4,18 +4,43 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 
+	"github.com/jessevdk/go-flags"
 	"github.com/v4sr/L0/KubeClient"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/util/homedir"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 )
 
-func printNode(clientset kubernetes.Clientset, node string) {
+type NodeOptions struct {
+	ListPods bool `short:"l" long:"list-pods" description:"List all pods in the node"`
+}
+
+type NodeCommand struct {
+	Node     string      `positional-arg-name:"node" description:"Node name" required:"true"`
+	NodeOpts NodeOptions `command:"" description:"Node options"`
+}
+
+type NamespaceOptions struct {
+	ListPods        bool `short:"l" long:"list-pods" description:"List all pods in the namespace"`
+	ListDeployments bool `long:"list-deploy" description:"List all deployments in the namespace"`
+}
+
+type NSCommand struct {
+	Namespace string           `positional-arg-name:"namespace" description:"Namespace name" required:"true"`
+	NSOpts    NamespaceOptions `command:"" description:"Namespace options"`
+}
+
+type Options struct {
+	NodeCommand `command:"node" description:"Node options"`
+	NSCommand   `command:"namespace" description:"Namespace options"`
+	Kubeconfig  string `long:"kubeconfig" description:"Path to the kubeconfig file, or a list of paths as in KUBECONFIG"`
+	Context     string `long:"context" description:"Kubeconfig context to use"`
+}
+
+func printNode(clientset kubernetes.Interface, node string) {
 	nodeList, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
 		panic(err)
@@ -26,34 +51,34 @@ func printNode(clientset kubernetes.Clientset, node string) {
 	}
 }
 
-func getPo(clientset kubernetes.Clientset, ns_or_node_flag string, ns_or_node_name string) (*corev1.PodList, error) {
+func getPo(clientset kubernetes.Interface, ns_or_node_flag string, ns_or_node_name string) (*corev1.PodList, error) {
 	var pods *corev1.PodList
 	var err error
 
 	switch ns_or_node_flag {
 	case "namespace":
-		check, err := nsExists(clientset, ns_or_node_name)
-		if !check || err != nil {
-			return nil, fmt.Errorf("namespace %s not available or existing: %w", ns_or_node_name, err)
+		_, err := KubeClient.GetNamespace(context.Background(), clientset, ns_or_node_name)
+		if err != nil {
+			return nil, err
 		}
 
 		pods, err = clientset.CoreV1().Pods(ns_or_node_name).List(context.Background(), metav1.ListOptions{
 			FieldSelector: "spec.nodeName=" + ns_or_node_name,
 		})
 		if err != nil {
-			return nil, fmt.Errorf("error: %s", err)
+			return nil, fmt.Errorf("error retrieving pods: %w", KubeClient.Classify(err))
 		}
 	case "node":
-		check, err := nodeExists(clientset, ns_or_node_name)
-		if !check || err != nil {
-			return nil, fmt.Errorf("node %s not available or existing: %w", ns_or_node_name, err)
+		_, err := KubeClient.GetNode(context.Background(), clientset, ns_or_node_name)
+		if err != nil {
+			return nil, err
 		}
 
 		pods, err = clientset.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{
 			FieldSelector: "spec.nodeName=" + ns_or_node_name,
 		})
 		if err != nil {
-			return nil, fmt.Errorf("error: %s", err)
+			return nil, fmt.Errorf("error retrieving pods: %w", KubeClient.Classify(err))
 		}
 	}
 
@@ -68,15 +93,15 @@ func getPo(clientset kubernetes.Clientset, ns_or_node_flag string, ns_or_node_na
 	return pods, nil
 }
 
-func getDeploy(clientset kubernetes.Clientset, ns_name string) (*appsv1.DeploymentList, error) {
-	check, err := nsExists(clientset, ns_name)
-	if !check || err != nil {
-		return nil, fmt.Errorf("namespace %s not available or existing: %w", ns_name, err)
+func getDeploy(clientset kubernetes.Interface, ns_name string) (*appsv1.DeploymentList, error) {
+	_, err := KubeClient.GetNamespace(context.Background(), clientset, ns_name)
+	if err != nil {
+		return nil, err
 	}
 
 	deploys, err := clientset.AppsV1().Deployments(ns_name).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving deployments: %w", err)
+		return nil, fmt.Errorf("error retrieving deployments: %w", KubeClient.Classify(err))
 	}
 
 	for _, deploy := range deploys.Items {
@@ -86,46 +111,64 @@ func getDeploy(clientset kubernetes.Clientset, ns_name string) (*appsv1.Deployme
 	return deploys, nil
 }
 
+// fatal reports err and exits with the code scripts rely on to tell missing
+// resources, RBAC denials and unreachable clusters apart.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	os.Exit(KubeClient.ExitCode(err))
+}
+
 func main() {
-	kubeconfig := filepath.Join(homedir.HomeDir(), ".kube", "config")
+	var opts Options
+	parser := flags.NewParser(&opts, flags.Default)
+
+	_, err := parser.Parse()
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		os.Exit(KubeClient.ExitUsage)
+	}
 
-	_, clientset, err := KubeClient.BuildClient(kubeconfig)
+	client, err := KubeClient.NewClient(KubeClient.Options{
+		Kubeconfig: opts.Kubeconfig,
+		Context:    opts.Context,
+	})
 	if err != nil {
-		panic(err.Error())
+		fatal(err)
 	}
+	clientset := client.Clientset
 
 	switch parser.Active.Name {
 	case "node":
 		if opts.NodeCommand.Node == "" {
 			fmt.Println("Error: Please specify a node name.")
-			os.Exit(1)
+			os.Exit(KubeClient.ExitUsage)
 		}
 
 		node := opts.NodeCommand.Node
 		fmt.Printf("Node name: %s\n", node)
 		if opts.NodeOpts.ListPods {
-			_, err = getPo(*clientset, "node", node)
+			_, err = getPo(clientset, "node", node)
 			if err != nil {
-				fmt.Printf("Error: %s\n", err.Error())
+				fatal(err)
 			}
 		}
 	case "namespace":
 		if opts.NSCommand.Namespace == "" {
 			fmt.Println("Error: Please specify a namespace name")
-			os.Exit(1)
+			os.Exit(KubeClient.ExitUsage)
 		}
 
 		namespace := opts.NSCommand.Namespace
 		fmt.Printf("Namespace name: %s\n", namespace)
 		if opts.NSCommand.NSOpts.ListPods {
-			_, err = getPo(*clientset, "namespace", namespace)
+			_, err = getPo(clientset, "namespace", namespace)
 			if err != nil {
-				fmt.Printf("Error: %s\n", err.Error())
+				fatal(err)
 			}
 		} else if opts.NSCommand.NSOpts.ListDeployments {
-			_, err = getDeploy(*clientset, namespace)
+			_, err = getDeploy(clientset, namespace)
 			if err != nil {
-				fmt.Printf("Error: %s\n", err.Error())
+				fatal(err)
 			}
 		}
 	}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/v4sr/L0/KubeClient"
+	"github.com/v4sr/L0/KubeClient/fake"
+)
+
+func TestGetPoReportsMissingResources(t *testing.T) {
+	client, _ := fake.NewClient()
+
+	if _, err := getPo(client.Clientset, "namespace", "shop"); !errors.Is(err, KubeClient.ErrNamespaceNotFound) {
+		t.Errorf("missing namespace: %v", err)
+	}
+	if _, err := getPo(client.Clientset, "node", "worker-1"); !errors.Is(err, KubeClient.ErrNodeNotFound) {
+		t.Errorf("missing node: %v", err)
+	}
+	if _, err := getDeploy(client.Clientset, "shop"); !errors.Is(err, KubeClient.ErrNamespaceNotFound) {
+		t.Errorf("missing namespace: %v", err)
+	}
+}
+
+func TestGetDeploy(t *testing.T) {
+	client, _ := fake.NewClient(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "odoo", Namespace: "shop"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "odoo", Namespace: "other"}},
+	)
+
+	deploys, err := getDeploy(client.Clientset, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deploys.Items) != 1 || deploys.Items[0].Namespace != "shop" {
+		t.Errorf("deployments %+v", deploys.Items)
+	}
+}
+
+func TestGetPoOnNode(t *testing.T) {
+	client, _ := fake.NewClient(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "odoo", Namespace: "shop"}, Spec: corev1.PodSpec{NodeName: "worker-1"}},
+	)
+
+	pods, err := getPo(client.Clientset, "node", "worker-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].Name != "odoo" {
+		t.Errorf("pods %+v", pods.Items)
+	}
+}
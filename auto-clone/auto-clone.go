@@ -1,233 +1,147 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
-	"os/user"
+	"os/signal"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/client-go/util/homedir"
-)
-
-func BuildClient() (*rest.Config, *kubernetes.Clientset, error) {
-	var kubeconfig *string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
 
-	restcfg, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	if err != nil {
-		return nil, nil, fmt.Errorf("%w Error building ClientSet config", err)
-	}
+	"github.com/v4sr/L0/KubeClient"
+)
 
-	clientset, err := kubernetes.NewForConfig(restcfg)
+// getPo picks the pod to copy from or to in selected_ns: the one whose name
+// is pod, else the only one starting with it, asking when several match.
+// flag_name is the option that narrows it down without a terminal.
+func getPo(clientset kubernetes.Interface, selected_ns string, pod string, flag_name string) (*v1.Pod, error) {
+	_, err := KubeClient.GetNamespace(context.Background(), clientset, selected_ns)
 	if err != nil {
-		return nil, nil, fmt.Errorf("%w Error creating ClientSet", err)
-	}
-
-	return restcfg, clientset, nil
-}
-
-func nsExists(clientset kubernetes.Clientset, selected_ns string) (bool, error) {
-	_, err := clientset.CoreV1().Namespaces().Get(context.Background(), selected_ns, metav1.GetOptions{})
-	if err != nil {
-		if errors.IsNotFound(err) {
-			return false, nil
-		}
-
-		return false, fmt.Errorf("%w Error with namespace %s", err, selected_ns)
-	}
-
-	return true, nil
-}
-
-func getPo(clientset kubernetes.Clientset, selected_ns string) (*v1.Pod, error) {
-	check, err := nsExists(clientset, selected_ns)
-	if !check || err != nil {
-		return nil, fmt.Errorf("%w Namespace %s non available or existing", err, selected_ns)
+		return nil, err
 	}
 
 	pods, err := clientset.CoreV1().Pods(selected_ns).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("%w Error getting pods from namespace %s", err, selected_ns)
-	}
-
-	fmt.Printf("Pods from %s namespace:\n", selected_ns)
-	for i, pod := range pods.Items {
-		fmt.Printf("[%d] %s\n", i, pod.Name)
+		return nil, fmt.Errorf("error getting pods from namespace %s: %w", selected_ns, KubeClient.Classify(err))
 	}
 
-	fmt.Printf("Select a pod: ")
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("%w Error scanning index", err)
+	var matches []v1.Pod
+	for i := range pods.Items {
+		if pods.Items[i].Name == pod {
+			return &pods.Items[i], nil
+		}
+		if strings.HasPrefix(pods.Items[i].Name, pod) {
+			matches = append(matches, pods.Items[i])
+		}
 	}
 
-	selectedPodIndex, err := strconv.Atoi(scanner.Text())
-	if err != nil {
-		return nil, fmt.Errorf("%w Error converting string %s to int", err, scanner.Text())
+	switch len(matches) {
+	case 0:
+		if pod != "" {
+			return nil, fmt.Errorf("%w: no pod in namespace %s starts with %s", KubeClient.ErrPodNotFound, selected_ns, pod)
+		}
+		return nil, fmt.Errorf("%w: namespace %s has no pods", KubeClient.ErrPodNotFound, selected_ns)
+	case 1:
+		return &matches[0], nil
 	}
 
-	total_pods := len(pods.Items)
-	if selectedPodIndex < 0 || selectedPodIndex >= total_pods {
-		return nil, fmt.Errorf("Invalid pod index (out of range [0-%d])", total_pods)
+	selected_pod, err := KubeClient.PickPod("Pod in "+selected_ns, matches)
+	if errors.Is(err, KubeClient.ErrNoTerminal) {
+		return nil, fmt.Errorf("%d pods in namespace %s, pick one with --%s", len(matches), selected_ns, flag_name)
 	}
 
-	return &pods.Items[selectedPodIndex], nil
+	return selected_pod, err
 }
 
-func executeRemoteCommand(restcfg *rest.Config, clientset kubernetes.Clientset, selected_pod *v1.Pod, command string) (string, string, error) {
-	buf := &bytes.Buffer{}
-	errBuf := &bytes.Buffer{}
-	current_user, err := user.Current()
-	if err != nil {
-		return "", "", fmt.Errorf("%w Error getting current user", err)
-	}
-
-	if command == "ssh_check" {
-		command_2_exec := string("/bin/bash -c \"ssh" + current_user.Username + "@nbsd190.nanobytes.es -t 'sudo mkdir /media/migracion/" + current_user.Username + "/" + selected_pod.Namespace + "-" + time.Now().Format("240404") + "'\"")
-		fmt.Println(command_2_exec)
-		req := clientset.CoreV1().RESTClient().Post().
-			Resource("pods").
-			Name(selected_pod.Name).
-			Namespace(selected_pod.Namespace).
-			SubResource("exec").
-			VersionedParams(&v1.PodExecOptions{
-				Command: command_2_exec,
-				Stdin:   true,
-				Stdout:  true,
-				Stderr:  true,
-				TTY:     true,
-			}, scheme.ParameterCodec)
-
-		exec, err := remotecommand.NewSPDYExecutor(restcfg, "POST", req.URL())
-		if err != nil {
-			return "", "", fmt.Errorf("failed to create executor: %w", err)
-		}
-
-		err = exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{
-			Stdin:  os.Stdin,
-			Stdout: os.Stdout,
-			Stderr: os.Stderr,
-			Tty:    true,
-		})
-		if err != nil {
-			return "", "", fmt.Errorf("failed to execute command: %w", err)
-		}
+func printProgress(p KubeClient.CopyProgress) {
+	fmt.Fprintf(os.Stderr, "\r%d files, %.1f MiB", p.Files, float64(p.Bytes)/(1<<20))
+}
 
-		return "", "", nil
-	}
+func cloneFilestore(ctx context.Context, executor KubeClient.Executor, src_pod *v1.Pod, dst_pod *v1.Pod, filestore string) error {
+	src := KubeClient.PodPath{Namespace: src_pod.Namespace, Pod: src_pod.Name, Path: filestore}
+	dst := KubeClient.PodPath{Namespace: dst_pod.Namespace, Pod: dst_pod.Name, Path: filestore}
+	fmt.Printf("Copying %s -> %s\n", src, dst)
 
-	request := clientset.CoreV1().RESTClient().
-		Post().
-		Namespace(selected_pod.Namespace).
-		Resource("pods").
-		Name(selected_pod.Name).
-		SubResource("exec").
-		VersionedParams(&v1.PodExecOptions{
-			Command: []string{"/bin/bash", "-c", command},
-			Stdin:   false,
-			Stdout:  true,
-			Stderr:  true,
-			TTY:     false,
-		}, scheme.ParameterCodec)
-	exec, err := remotecommand.NewSPDYExecutor(restcfg, "POST", request.URL())
-	if err != nil {
-		return "", "", fmt.Errorf("failed to create executor: %w", err)
-	}
-	err = exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{
-		Stdout: buf,
-		Stderr: errBuf,
-	})
+	err := KubeClient.CopyBetweenPods(ctx, executor, src, dst, KubeClient.CopyOptions{Progress: printProgress})
+	fmt.Fprintln(os.Stderr)
 	if err != nil {
-		return "", "", fmt.Errorf("failed executing command: %w", err)
+		return fmt.Errorf("error cloning the filestore of %s into %s: %w", src_pod.Namespace, dst_pod.Namespace, err)
 	}
 
-	return buf.String(), errBuf.String(), nil
+	return nil
 }
 
-func podPackages(restcfg *rest.Config, clientset kubernetes.Clientset, selected_pod *v1.Pod) (string, string, error) {
-	command := "apt update && apt install rsync openssh-client -y"
-	//	command := "touch /var/lib/odoo/filestore/this_is_a_test.txt"
-	fmt.Println(command)
+func downloadFilestore(ctx context.Context, executor KubeClient.Executor, src_pod *v1.Pod, filestore string, local_dir string) error {
+	src := KubeClient.PodPath{Namespace: src_pod.Namespace, Pod: src_pod.Name, Path: filestore}
+	dst := filepath.Join(local_dir, src_pod.Namespace+"-"+time.Now().Format("060102"))
+	fmt.Printf("Copying %s -> %s\n", src, dst)
 
-	command_buf, command_err, err := executeRemoteCommand(restcfg, clientset, selected_pod, command)
+	err := KubeClient.CopyFromPod(ctx, executor, src, dst, KubeClient.CopyOptions{Progress: printProgress})
+	fmt.Fprintln(os.Stderr)
 	if err != nil {
-		return "", "", fmt.Errorf("Error: %w", err)
+		return fmt.Errorf("error downloading the filestore of %s: %w", src_pod.Namespace, err)
 	}
 
-	//	fmt.Println("Salio")
-
-	return command_buf, command_err, nil
+	return nil
 }
 
-func parallelRsync(restcfg *rest.Config, clientset kubernetes.Clientset, selected_pod *v1.Pod) (string, string, error) {
-	command_buf, command_err, err := executeRemoteCommand(restcfg, clientset, selected_pod, "ssh_check")
-	if err != nil {
-		return "", "", fmt.Errorf("Error: %w", err)
-	}
-
-	return command_buf, command_err, nil
+// fatal reports err and exits with the code scripts rely on to tell missing
+// resources, RBAC denials and unreachable clusters apart.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	os.Exit(KubeClient.ExitCode(err))
 }
 
 func main() {
-	argsWithoutProg := os.Args[1:]
-	if len(argsWithoutProg) < 2 {
-		log.Fatal("Use: ./auto-clone <SOURCE_NS> <DESTINATION_NS>")
-	} else if argsWithoutProg[0] == "" || argsWithoutProg[1] == "" {
-		log.Fatal("Use: ./auto-clone <SOURCE_NS> <DESTINATION_NS>")
-	}
+	var clientOpts KubeClient.Options
+	clientOpts.BindFlags(flag.CommandLine)
+	filestore := flag.String("path", "/var/lib/odoo/filestore", "directory copied between the pods")
+	local_dir := flag.String("local", "", "download the source directory under this local directory instead of cloning it")
+	src_pod_name := flag.String("src-pod", "", "source pod name, or a prefix of it, asked for when several match")
+	dst_pod_name := flag.String("dst-pod", "", "destination pod name, or a prefix of it, asked for when several match")
+	flag.Parse()
 
-	selected_ns := argsWithoutProg[0]
+	argsWithoutProg := flag.Args()
+	if *local_dir == "" && len(argsWithoutProg) < 2 || len(argsWithoutProg) < 1 {
+		fmt.Fprintln(os.Stderr, "Use: ./auto-clone [--kubeconfig PATH] [--context NAME] [--override-protected] [--path DIR] [--src-pod NAME] [--dst-pod NAME] <SOURCE_NS> <DESTINATION_NS>\n     ./auto-clone [--path DIR] [--src-pod NAME] --local <LOCAL_DIR> <SOURCE_NS>")
+		os.Exit(KubeClient.ExitUsage)
+	}
 
-	restcfg, clientset, err := BuildClient()
+	client, err := KubeClient.NewClient(clientOpts)
 	if err != nil {
-		panic(err.Error())
+		fatal(err)
 	}
 
-	selected_pod, err := getPo(*clientset, selected_ns)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	src_pod, err := getPo(client.Clientset, argsWithoutProg[0], *src_pod_name, "src-pod")
 	if err != nil {
-		panic(err.Error())
+		fatal(err)
 	}
-	/**
-		command_buf, command_err, err := podPackages(restcfg, *clientset, selected_pod)
-		if err != nil {
-			panic(err.Error())
-		}
 
-		if command_err != "" {
-			panic(command_err)
+	if *local_dir != "" {
+		err = downloadFilestore(ctx, client.Executor, src_pod, *filestore, *local_dir)
+		if err != nil {
+			fatal(err)
 		}
+		return
+	}
 
-		fmt.Println(command_buf)
-	**/
-	command_buf, command_err, err := parallelRsync(restcfg, *clientset, selected_pod)
+	dst_pod, err := getPo(client.Clientset, argsWithoutProg[1], *dst_pod_name, "dst-pod")
 	if err != nil {
-		panic(err.Error())
+		fatal(err)
 	}
 
-	if command_err != "" {
-		panic(command_err)
+	err = cloneFilestore(ctx, client.Executor, src_pod, dst_pod, *filestore)
+	if err != nil {
+		fatal(err)
 	}
-
-	fmt.Println(command_buf)
 }
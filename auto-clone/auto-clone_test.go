@@ -0,0 +1,149 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/v4sr/L0/KubeClient"
+	"github.com/v4sr/L0/KubeClient/fake"
+)
+
+// filestoreArchive is what tar cf sends for a filestore with one file.
+func filestoreArchive(t *testing.T) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []tar.Header{
+		{Name: "filestore/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "filestore/ab/abcdef", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+	} {
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Write([]byte("data"))
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func odooPod(namespace string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "odoo-0", Namespace: namespace}}
+}
+
+func TestCloneFilestore(t *testing.T) {
+	_, exec := fake.NewClient()
+	exec.On("tar cf - -C /var/lib/odoo filestore", fake.Response{Stdout: filestoreArchive(t)})
+	exec.On(`sh -c mkdir -p "$1" && tar -xpf - -C "$1" sh /var/lib/odoo`, fake.Response{})
+
+	if err := cloneFilestore(context.Background(), exec, odooPod("prod"), odooPod("staging"), "/var/lib/odoo/filestore"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exec.Calls) != 2 {
+		t.Fatalf("%d execs", len(exec.Calls))
+	}
+	for _, call := range exec.Calls {
+		want := "prod"
+		if call.Stdin != nil {
+			want = "staging"
+		}
+		if call.Namespace != want {
+			t.Errorf("%v ran in %s, want %s", call.Command, call.Namespace, want)
+		}
+	}
+}
+
+func TestCloneFilestoreReportsFailure(t *testing.T) {
+	_, exec := fake.NewClient()
+	exec.On("tar cf - -C /var/lib/odoo filestore", fake.Response{Stdout: filestoreArchive(t)})
+	exec.On(`sh -c mkdir -p "$1" && tar -xpf - -C "$1" sh /var/lib/odoo`, fake.Response{Stderr: "tar: No space left on device", ExitCode: 2})
+
+	err := cloneFilestore(context.Background(), exec, odooPod("prod"), odooPod("staging"), "/var/lib/odoo/filestore")
+	var exit_err *KubeClient.ExitError
+	if !errors.As(err, &exit_err) || exit_err.Code != 2 {
+		t.Fatalf("cloneFilestore = %v", err)
+	}
+}
+
+func TestDownloadFilestore(t *testing.T) {
+	_, exec := fake.NewClient()
+	exec.On("tar cf - -C /var/lib/odoo filestore", fake.Response{Stdout: filestoreArchive(t)})
+
+	local := t.TempDir()
+	if err := downloadFilestore(context.Background(), exec, odooPod("prod"), "/var/lib/odoo/filestore", local); err != nil {
+		t.Fatal(err)
+	}
+
+	copies, _ := filepath.Glob(filepath.Join(local, "prod-*"))
+	if len(copies) != 1 {
+		t.Fatalf("copies %v", copies)
+	}
+	data, err := os.ReadFile(filepath.Join(copies[0], "ab", "abcdef"))
+	if err != nil || string(data) != "data" {
+		t.Errorf("downloaded file %q, %v", data, err)
+	}
+}
+
+func TestGetPoWithoutPods(t *testing.T) {
+	client, _ := fake.NewClient(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod"}})
+
+	if _, err := getPo(client.Clientset, "prod", "", "src-pod"); !errors.Is(err, KubeClient.ErrPodNotFound) {
+		t.Errorf("empty namespace: %v", err)
+	}
+	if _, err := getPo(client.Clientset, "missing", "", "src-pod"); !errors.Is(err, KubeClient.ErrNamespaceNotFound) {
+		t.Errorf("missing namespace: %v", err)
+	}
+}
+
+func TestGetPoWithoutTerminal(t *testing.T) {
+	client, _ := fake.NewClient(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod"}},
+		odooPod("prod"),
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "odoo-1", Namespace: "prod"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "postgres-0", Namespace: "prod"}},
+	)
+
+	tests := []struct {
+		pod  string
+		want string
+	}{
+		{"postgres", "postgres-0"},
+		{"odoo-0", "odoo-0"},
+	}
+	for _, test := range tests {
+		pod, err := getPo(client.Clientset, "prod", test.pod, "src-pod")
+		if err != nil || pod.Name != test.want {
+			t.Errorf("getPo(%q) = %v, %v, want %s", test.pod, pod, err, test.want)
+		}
+	}
+
+	// Tests have no terminal to ask on.
+	if _, err := getPo(client.Clientset, "prod", "odoo", "src-pod"); err == nil || !strings.Contains(err.Error(), "--src-pod") {
+		t.Errorf("several matches without a terminal: %v", err)
+	}
+	if _, err := getPo(client.Clientset, "prod", "redis", "src-pod"); !errors.Is(err, KubeClient.ErrPodNotFound) {
+		t.Errorf("no match: %v", err)
+	}
+}
+
+func TestGetPoPicksTheOnlyPod(t *testing.T) {
+	client, _ := fake.NewClient(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod"}}, odooPod("prod"))
+
+	pod, err := getPo(client.Clientset, "prod", "", "src-pod")
+	if err != nil || pod.Name != "odoo-0" {
+		t.Errorf("getPo = %v, %v", pod, err)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// runbook is a fixed sequence of commands run in one container. It is read
+// from YAML (or JSON):
+//
+//	timeout: 5m
+//	steps:
+//	  - name: clear sessions
+//	    run: rm -rf /var/lib/odoo/sessions/*
+//	    continue_on_error: true
+//	  - run: test -f /var/lib/odoo/.lock
+//	    expect: 1
+//	    timeout: 10s
+//
+// or from a plain file with one command per line, # starting a comment.
+type runbook struct {
+	// Timeout and ContinueOnError are the defaults of every step.
+	Timeout         string        `json:"timeout"`
+	ContinueOnError bool          `json:"continue_on_error"`
+	Steps           []runbookStep `json:"steps"`
+}
+
+type runbookStep struct {
+	Name string `json:"name"`
+	// Run is passed to /bin/sh -c.
+	Run string `json:"run"`
+	// Expect is the exit code that counts as success.
+	Expect int `json:"expect"`
+	// Timeout is a duration such as 30s, 0 for none.
+	Timeout         string `json:"timeout"`
+	ContinueOnError *bool  `json:"continue_on_error"`
+
+	timeout time.Duration
+}
+
+// parseRunbook reads a YAML runbook when the file is named .yaml, .yml or
+// .json, a line based one otherwise. timeout and continue_on_error are the
+// defaults when the runbook sets none.
+func parseRunbook(name string, data []byte, timeout time.Duration, continue_on_error bool) (*runbook, error) {
+	book := &runbook{ContinueOnError: continue_on_error}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		if err := yaml.UnmarshalStrict(data, book); err != nil {
+			return nil, fmt.Errorf("invalid runbook %s: %w", name, err)
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				book.Steps = append(book.Steps, runbookStep{Run: line})
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading runbook %s: %w", name, err)
+		}
+	}
+
+	if book.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(book.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout in %s: %w", name, err)
+		}
+	}
+	if len(book.Steps) == 0 {
+		return nil, fmt.Errorf("runbook %s has no steps", name)
+	}
+
+	for i := range book.Steps {
+		step := &book.Steps[i]
+		if strings.TrimSpace(step.Run) == "" {
+			return nil, fmt.Errorf("step %d of %s has nothing to run", i+1, name)
+		}
+		if step.Name == "" {
+			step.Name = strings.SplitN(strings.TrimSpace(step.Run), "\n", 2)[0]
+		}
+		if step.ContinueOnError == nil {
+			step.ContinueOnError = &book.ContinueOnError
+		}
+
+		step.timeout = timeout
+		if step.Timeout != "" {
+			var err error
+			if step.timeout, err = time.ParseDuration(step.Timeout); err != nil {
+				return nil, fmt.Errorf("invalid timeout in step %d of %s: %w", i+1, name, err)
+			}
+		}
+	}
+
+	return book, nil
+}
+
+// batchStep is the outcome of one step. Status is ok, failed, ignored for a
+// failure that continue_on_error let through, or skipped.
+type batchStep struct {
+	Step    int           `json:"step"`
+	Name    string        `json:"name"`
+	Command string        `json:"command"`
+	Expect  int           `json:"expect"`
+	Status  string        `json:"status"`
+	Result  *fanoutResult `json:"result,omitempty"`
+}
+
+type batchReport struct {
+	Runbook   string      `json:"runbook"`
+	Namespace string      `json:"namespace"`
+	Pod       string      `json:"pod"`
+	Container string      `json:"container"`
+	Failed    int         `json:"failed"`
+	Ignored   int         `json:"ignored"`
+	Skipped   int         `json:"skipped"`
+	Steps     []batchStep `json:"steps"`
+}
+
+func printBatchStep(step batchStep, total int) {
+	status := step.Status
+	if result := step.Result; result != nil {
+		if result.Error != "" {
+			status += ", " + result.Error
+		} else {
+			status += fmt.Sprintf(", exit=%d", result.ExitCode)
+			if step.Expect != 0 {
+				status += fmt.Sprintf(" (expected %d)", step.Expect)
+			}
+		}
+		status += fmt.Sprintf(" in %.1fs", result.Duration)
+	}
+	fmt.Printf("=== [%d/%d] %s: %s\n", step.Step, total, step.Name, status)
+
+	if step.Result != nil {
+		printOutput(*step.Result)
+	}
+}
+
+func batchCommand(args []string) error {
+	var clientOpts KubeClient.Options
+	var sel podSelection
+	var container string
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	clientOpts.BindFlags(fs)
+	sel.BindFlags(fs)
+	bindContainerFlags(fs, &container)
+	timeout := fs.Duration("timeout", 0, "timeout of steps that set none, e.g. 5m")
+	continue_on_error := fs.Bool("continue-on-error", false, "go on after failed steps that do not say otherwise")
+	json_output := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc batch [POD SELECTION FLAGS] [-c CONTAINER] [--timeout D] [--continue-on-error] [--json] <NAMESPACE> <RUNBOOK>")
+		fmt.Fprintln(fs.Output(), "     runs the steps of RUNBOOK (.yaml, or one command per line) in order in one container")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+	runbook_path := fs.Arg(1)
+
+	data, err := os.ReadFile(runbook_path)
+	if err != nil {
+		return fmt.Errorf("error reading runbook: %w", err)
+	}
+	book, err := parseRunbook(runbook_path, data, *timeout, *continue_on_error)
+	if err != nil {
+		return err
+	}
+
+	selected, err := expandNamespace(fs.Arg(0), &clientOpts)
+	if err != nil {
+		return err
+	}
+	applyBookmark(selected, &sel, &container)
+
+	client, err := KubeClient.NewClient(clientOpts)
+	if err != nil {
+		return err
+	}
+
+	selected_pod, err := getPo(client.Clientset, selected.Namespace, sel)
+	if err != nil {
+		return err
+	}
+	container, err = getContainer(selected_pod, container, false)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Ask about protected namespaces before the first step rather than in
+	// the middle of the output.
+	if err := client.Guard.Check(ctx, selected_pod.Namespace); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Running %d steps of %s in %s/%s (%s)\n", len(book.Steps), runbook_path, selected_pod.Namespace, selected_pod.Name, container)
+
+	report := batchReport{
+		Runbook:   runbook_path,
+		Namespace: selected_pod.Namespace,
+		Pod:       selected_pod.Name,
+		Container: container,
+	}
+	stopped := false
+	for i, step := range book.Steps {
+		outcome := batchStep{Step: i + 1, Name: step.Name, Command: step.Run, Expect: step.Expect}
+
+		switch {
+		case stopped || ctx.Err() != nil:
+			outcome.Status = "skipped"
+			report.Skipped++
+		default:
+			result := fanoutExec(ctx, client, selected_pod, container, step.Run, step.timeout)
+			outcome.Result = &result
+
+			switch {
+			case result.Error == "" && result.ExitCode == step.Expect:
+				outcome.Status = "ok"
+			case *step.ContinueOnError:
+				outcome.Status = "ignored"
+				report.Ignored++
+			default:
+				outcome.Status = "failed"
+				report.Failed++
+				stopped = true
+			}
+		}
+
+		report.Steps = append(report.Steps, outcome)
+		if !*json_output {
+			printBatchStep(outcome, len(book.Steps))
+		}
+	}
+
+	if *json_output {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("\n%d steps, %d ok, %d failed, %d ignored, %d skipped\n", len(report.Steps),
+			len(report.Steps)-report.Failed-report.Ignored-report.Skipped, report.Failed, report.Ignored, report.Skipped)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("runbook %s failed", runbook_path)
+	}
+
+	return nil
+}
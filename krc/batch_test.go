@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRunbookYAML(t *testing.T) {
+	book, err := parseRunbook("maintenance.yaml", []byte(`
+timeout: 5m
+steps:
+  - name: clear sessions
+    run: rm -rf /var/lib/odoo/sessions/*
+    continue_on_error: true
+  - run: |
+      test -f /var/lib/odoo/.lock
+      echo locked
+    expect: 1
+    timeout: 10s
+`), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Steps) != 2 {
+		t.Fatalf("%d steps", len(book.Steps))
+	}
+
+	first, second := book.Steps[0], book.Steps[1]
+	if first.Name != "clear sessions" || !*first.ContinueOnError || first.timeout != 5*time.Minute {
+		t.Errorf("first step %+v", first)
+	}
+	if second.Name != "test -f /var/lib/odoo/.lock" || *second.ContinueOnError || second.Expect != 1 || second.timeout != 10*time.Second {
+		t.Errorf("second step %+v", second)
+	}
+}
+
+func TestParseRunbookLines(t *testing.T) {
+	book, err := parseRunbook("steps.txt", []byte("# warm up\nls /var/lib/odoo\n\n  df -h  \n"), time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Steps) != 2 || book.Steps[0].Run != "ls /var/lib/odoo" || book.Steps[1].Run != "df -h" {
+		t.Fatalf("steps %+v", book.Steps)
+	}
+	if !*book.Steps[1].ContinueOnError || book.Steps[1].timeout != time.Minute {
+		t.Errorf("defaults not applied: %+v", book.Steps[1])
+	}
+}
+
+func TestParseRunbookRejects(t *testing.T) {
+	for name, data := range map[string]string{
+		"empty.txt":    "# nothing\n",
+		"unknown.yaml": "steps:\n  - run: ls\n    retries: 3\n",
+		"blank.yaml":   "steps:\n  - name: nothing\n",
+		"timeout.yaml": "timeout: soon\nsteps:\n  - run: ls\n",
+		"step.yaml":    "steps:\n  - run: ls\n    timeout: 5\n",
+	} {
+		if _, err := parseRunbook(name, []byte(data), 0, false); err == nil {
+			t.Errorf("%s should be rejected", name)
+		}
+	}
+}
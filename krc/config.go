@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// krcConfig is read from $KRC_CONFIG, or config.yaml in the krc user config
+// directory. A team can ship it to enforce settings such as recording.
+type krcConfig struct {
+	Record recordConfig `json:"record"`
+}
+
+type recordConfig struct {
+	// Enabled records every interactive session unless --no-record is given.
+	Enabled bool `json:"enabled"`
+	// Required records every interactive session and rejects --no-record.
+	Required bool `json:"required"`
+	// Dir is where recordings go, ~/.local/share/krc/recordings by default.
+	Dir string `json:"dir"`
+}
+
+// configDir is the krc directory under the user config directory, e.g.
+// ~/.config/krc.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating the config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "krc"), nil
+}
+
+func loadConfig() (krcConfig, error) {
+	var cfg krcConfig
+
+	path := os.Getenv("KRC_CONFIG")
+	if path == "" {
+		dir, err := configDir()
+		if err != nil {
+			return cfg, err
+		}
+		path = filepath.Join(dir, "config.yaml")
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("error reading config: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
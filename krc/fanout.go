@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// fanoutResult is what one target returned. ExitCode is -1 when the command
+// could not be run at all, Error says why.
+type fanoutResult struct {
+	Namespace string  `json:"namespace"`
+	Pod       string  `json:"pod"`
+	Container string  `json:"container"`
+	Stdout    string  `json:"stdout"`
+	Stderr    string  `json:"stderr"`
+	ExitCode  int     `json:"exit_code"`
+	Error     string  `json:"error,omitempty"`
+	Duration  float64 `json:"duration_seconds"`
+}
+
+type fanoutReport struct {
+	Command string         `json:"command"`
+	Targets int            `json:"targets"`
+	Failed  int            `json:"failed"`
+	Results []fanoutResult `json:"results"`
+}
+
+// defaultContainer is the container kubectl would pick without -c.
+func defaultContainer(pod *v1.Pod) string {
+	if name := pod.Annotations[defaultContainerAnnotation]; name != "" {
+		return name
+	}
+
+	return pod.Spec.Containers[0].Name
+}
+
+// fanoutTargets lists the running pods matching sel in every namespace
+// whose name matches ns_regex.
+func fanoutTargets(ctx context.Context, client *KubeClient.Client, ns_regex *regexp.Regexp, sel podSelection) ([]v1.Pod, error) {
+	namespace_list, err := client.Clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing namespaces: %w", KubeClient.Classify(err))
+	}
+
+	var targets []v1.Pod
+	for _, namespace := range namespace_list.Items {
+		if !ns_regex.MatchString(namespace.Name) {
+			continue
+		}
+
+		pods, err := client.Clientset.CoreV1().Pods(namespace.Name).List(ctx, metav1.ListOptions{
+			LabelSelector: sel.labelSelector(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting pods from namespace %s: %w", namespace.Name, KubeClient.Classify(err))
+		}
+
+		var running []v1.Pod
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == v1.PodRunning && pod.DeletionTimestamp == nil {
+				running = append(running, pod)
+			}
+		}
+
+		matches, err := matchPods(running, sel)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", namespace.Name, err)
+		}
+		targets = append(targets, matches...)
+	}
+
+	return targets, nil
+}
+
+func fanoutExec(ctx context.Context, client *KubeClient.Client, pod *v1.Pod, container string, command string, timeout time.Duration) fanoutResult {
+	if container == "" {
+		container = defaultContainer(pod)
+	}
+	result := fanoutResult{Namespace: pod.Namespace, Pod: pod.Name, Container: container}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	stdout, stderr, err := KubeClient.Run(ctx, client.Executor, KubeClient.ExecOptions{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Command:   []string{"/bin/sh", "-c", command},
+	})
+	result.Duration = time.Since(start).Seconds()
+	result.Stdout = stdout
+	result.Stderr = stderr
+
+	var exit_err *KubeClient.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exit_err):
+		result.ExitCode = exit_err.Code
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.ExitCode = -1
+		result.Error = fmt.Sprintf("timed out after %s", timeout)
+	default:
+		result.ExitCode = -1
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// printOutput prints what the command of result wrote, stderr after stdout.
+func printOutput(result fanoutResult) {
+	if result.Stdout != "" {
+		fmt.Print(result.Stdout)
+		if !strings.HasSuffix(result.Stdout, "\n") {
+			fmt.Println()
+		}
+	}
+	if result.Stderr != "" {
+		fmt.Println("--- stderr")
+		fmt.Print(result.Stderr)
+		if !strings.HasSuffix(result.Stderr, "\n") {
+			fmt.Println()
+		}
+	}
+}
+
+func printFanoutReport(report fanoutReport) {
+	for _, result := range report.Results {
+		status := fmt.Sprintf("exit=%d", result.ExitCode)
+		if result.Error != "" {
+			status = "error: " + result.Error
+		}
+		fmt.Printf("=== %s/%s (%s) %s in %.1fs\n", result.Namespace, result.Pod, result.Container, status, result.Duration)
+		printOutput(result)
+	}
+
+	fmt.Printf("\n%d targets, %d ok, %d failed\n", report.Targets, report.Targets-report.Failed, report.Failed)
+}
+
+func fanoutCommand(args []string) error {
+	var clientOpts KubeClient.Options
+	var sel podSelection
+	var container string
+	fs := flag.NewFlagSet("fanout", flag.ExitOnError)
+	clientOpts.BindFlags(fs)
+	sel.BindFlags(fs)
+	bindContainerFlags(fs, &container)
+	namespaces := fs.String("ns", "", "regular expression the namespaces must match, e.g. '^tenant-'")
+	workers := fs.Int("workers", 8, "commands running at the same time")
+	timeout := fs.Duration("timeout", 0, "timeout per target, e.g. 30s")
+	json_output := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc fanout --ns REGEX [POD SELECTION FLAGS] [-c CONTAINER] [--workers N] [--timeout D] [--json] COMMAND...")
+		fmt.Fprintln(fs.Output(), "     runs COMMAND with /bin/sh in every matching running pod")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *namespaces == "" || fs.NArg() == 0 || *workers < 1 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+	ns_regex, err := regexp.Compile(*namespaces)
+	if err != nil {
+		return fmt.Errorf("invalid --ns regex: %w", err)
+	}
+	command := strings.Join(fs.Args(), " ")
+
+	client, err := KubeClient.NewClient(clientOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	targets, err := fanoutTargets(ctx, client, ns_regex, sel)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("%w: no running pods match %s in namespaces matching %q", KubeClient.ErrPodNotFound, sel, *namespaces)
+	}
+	fmt.Fprintf(os.Stderr, "Running %q on %d pods with %d workers\n", command, len(targets), *workers)
+
+	results := make([]fanoutResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < *workers && w < len(targets); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = fanoutExec(ctx, client, &targets[i], container, command, *timeout)
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Namespace != results[j].Namespace {
+			return results[i].Namespace < results[j].Namespace
+		}
+		return results[i].Pod < results[j].Pod
+	})
+
+	report := fanoutReport{Command: command, Targets: len(results), Results: results}
+	for _, result := range results {
+		if result.ExitCode != 0 {
+			report.Failed++
+		}
+	}
+
+	if *json_output {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printFanoutReport(report)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", report.Failed, report.Targets)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/v4sr/L0/KubeClient"
+	"github.com/v4sr/L0/clipboard"
+)
+
+// fuzzyScore rates how well pattern matches name, 0 meaning no match:
+// exact, prefix, substring, then the letters of pattern in order.
+func fuzzyScore(name string, pattern string) int {
+	name = strings.ToLower(name)
+	pattern = strings.ToLower(pattern)
+
+	switch {
+	case name == pattern:
+		return 4
+	case strings.HasPrefix(name, pattern):
+		return 3
+	case strings.Contains(name, pattern):
+		return 2
+	}
+
+	rest := name
+	for _, r := range pattern {
+		i := strings.IndexRune(rest, r)
+		if i < 0 {
+			return 0
+		}
+		rest = rest[i+len(string(r)):]
+	}
+
+	return 1
+}
+
+// searchNamespace lists the namespaces matching ilike_ns, fuzzily or as a
+// regex, best matches first.
+func searchNamespace(ctx context.Context, clientset kubernetes.Interface, ilike_ns string, use_regex bool) ([]v1.Namespace, error) {
+	namespace_list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting ilike namespace %s: %w", ilike_ns, KubeClient.Classify(err))
+	}
+
+	var namespace_regex *regexp.Regexp
+	if use_regex {
+		namespace_regex, err = regexp.Compile("(?i)" + ilike_ns)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace regex %q: %w", ilike_ns, err)
+		}
+	}
+
+	scores := map[string]int{}
+	var ilike_list []v1.Namespace
+	for _, namespace := range namespace_list.Items {
+		score := 0
+		if namespace_regex != nil {
+			if namespace_regex.MatchString(namespace.Name) {
+				score = 1
+			}
+		} else {
+			score = fuzzyScore(namespace.Name, ilike_ns)
+		}
+
+		if score > 0 {
+			scores[namespace.Name] = score
+			ilike_list = append(ilike_list, namespace)
+		}
+	}
+
+	sort.Slice(ilike_list, func(i, j int) bool {
+		a, b := ilike_list[i].Name, ilike_list[j].Name
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return a < b
+	})
+
+	return ilike_list, nil
+}
+
+func printNamespaces(namespaces []v1.Namespace) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tSTATUS\tAGE")
+	for _, namespace := range namespaces {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", namespace.Name, namespace.Status.Phase, KubeClient.Age(namespace.CreationTimestamp))
+	}
+	w.Flush()
+}
+
+func findCommand(args []string) error {
+	var clientOpts KubeClient.Options
+	var sel podSelection
+	var container string
+	var debug debugSettings
+	var record recordSettings
+	fs := flag.NewFlagSet("find", flag.ExitOnError)
+	clientOpts.BindFlags(fs)
+	sel.BindFlags(fs)
+	bindContainerFlags(fs, &container)
+	debug.BindFlags(fs)
+	record.BindFlags(fs)
+	use_regex := fs.Bool("regex", false, "PATTERN is a regular expression instead of a fuzzy match")
+	no_copy := fs.Bool("no-copy", false, "do not copy the selected namespace to the clipboard")
+	shell := fs.Bool("shell", false, "go on to pick a pod of the namespace and open a shell in it")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc find [--regex] [--no-copy] [--shell [POD SELECTION FLAGS]] <PATTERN>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+
+	client, err := KubeClient.NewClient(clientOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	namespaces, err := searchNamespace(ctx, client.Clientset, fs.Arg(0), *use_regex)
+	if err != nil {
+		return err
+	}
+	if len(namespaces) == 0 {
+		return fmt.Errorf("%w: nothing matches %q", KubeClient.ErrNamespaceNotFound, fs.Arg(0))
+	}
+
+	selected_ns := namespaces[0].Name
+	if len(namespaces) > 1 {
+		recentNamespacesFirst(namespaces)
+		selected_ns, err = KubeClient.PickNamespace(fmt.Sprintf("Namespaces matching %q", fs.Arg(0)), namespaces)
+		if errors.Is(err, KubeClient.ErrNoTerminal) {
+			printNamespaces(namespaces)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !*no_copy {
+		clipboardUtil := clipboard.NewClipboardUtil()
+		if err := clipboardUtil.Copy(selected_ns); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not copy %s to the clipboard: %s\n", selected_ns, err)
+		} else {
+			fmt.Printf("Copied %s to the clipboard\n", selected_ns)
+		}
+	}
+
+	if !*shell {
+		return nil
+	}
+
+	selected_pod, err := getPo(client.Clientset, selected_ns, sel)
+	if err != nil {
+		return err
+	}
+	container, err = getContainer(selected_pod, container, false)
+	if err != nil {
+		return err
+	}
+	rememberSelection(client, selected_pod, container)
+
+	return openShell(ctx, client, selected_pod, container, debug, record)
+}
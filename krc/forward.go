@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// podPorts lists the container ports declared by the pod, or only by the
+// container named only when it is set, used when forward gets no explicit
+// ports.
+func podPorts(pod *v1.Pod, only string) []string {
+	var ports []string
+	for _, container := range pod.Spec.Containers {
+		if only != "" && container.Name != only {
+			continue
+		}
+		for _, port := range container.Ports {
+			if port.Protocol == "" || port.Protocol == v1.ProtocolTCP {
+				ports = append(ports, strconv.Itoa(int(port.ContainerPort)))
+			}
+		}
+	}
+
+	return ports
+}
+
+func forwardCommand(args []string) error {
+	var clientOpts KubeClient.Options
+	var sel podSelection
+	var container string
+	fs := flag.NewFlagSet("forward", flag.ExitOnError)
+	clientOpts.BindFlags(fs)
+	sel.BindFlags(fs)
+	fs.StringVar(&container, "c", "", "only default to the ports of this container")
+	fs.StringVar(&container, "container", "", "only default to the ports of this container")
+	address := fs.String("address", "localhost", "local address to listen on")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc forward [--address ADDR] [POD SELECTION FLAGS] [-c CONTAINER] <NAMESPACE> [[LOCAL]:REMOTE ...]")
+		fmt.Fprintln(fs.Output(), "     ports default to the ones declared by the pod, e.g. 8069 for Odoo or 5432 for Postgres")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+	selected, err := expandNamespace(fs.Arg(0), &clientOpts)
+	if err != nil {
+		return err
+	}
+	applyBookmark(selected, &sel, &container)
+	selected_ns := selected.Namespace
+
+	client, err := KubeClient.NewClient(clientOpts)
+	if err != nil {
+		return err
+	}
+
+	selected_pod, err := getPo(client.Clientset, selected_ns, sel)
+	if err != nil {
+		return err
+	}
+	if selected_pod.Status.Phase != v1.PodRunning {
+		return fmt.Errorf("pod %s is %s, port-forward needs a running pod", selected_pod.Name, selected_pod.Status.Phase)
+	}
+
+	ports := fs.Args()[1:]
+	if len(ports) == 0 {
+		ports = podPorts(selected_pod, container)
+	}
+	if len(ports) == 0 {
+		return fmt.Errorf("pod %s declares no ports, pass them explicitly", selected_pod.Name)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ready := make(chan []KubeClient.ForwardedPort, 1)
+	go func() {
+		select {
+		case bound := <-ready:
+			for _, port := range bound {
+				fmt.Printf("Forwarding %s:%d -> %s:%d\n", *address, port.Local, selected_pod.Name, port.Remote)
+			}
+			fmt.Println("Press Ctrl-C to stop")
+		case <-ctx.Done():
+		}
+	}()
+
+	return client.PortForward(ctx, KubeClient.ForwardOptions{
+		Namespace: selected_pod.Namespace,
+		Pod:       selected_pod.Name,
+		Ports:     ports,
+		Addresses: []string{*address},
+		Ready:     ready,
+		ErrOut:    os.Stderr,
+	})
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// maxRecent bounds the most recently used list.
+const maxRecent = 50
+
+var aliasName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// bookmark is a saved namespace, pod and container selection. Pod is a name
+// prefix, so it survives the pod being replaced.
+type bookmark struct {
+	Context   string     `json:"context,omitempty"`
+	Namespace string     `json:"namespace"`
+	Pod       string     `json:"pod,omitempty"`
+	Container string     `json:"container,omitempty"`
+	Time      *time.Time `json:"time,omitempty"`
+}
+
+func (b bookmark) String() string {
+	s := b.Namespace
+	if b.Pod != "" {
+		s += "/" + b.Pod + "*"
+	}
+	if b.Container != "" {
+		s += " -c " + b.Container
+	}
+	if b.Context != "" {
+		s += " (" + b.Context + ")"
+	}
+
+	return s
+}
+
+// bookmarkStore holds the aliases and the most recently used selections,
+// newest first, in bookmarks.json of the krc config directory.
+type bookmarkStore struct {
+	Aliases map[string]bookmark `json:"aliases"`
+	Recent  []bookmark          `json:"recent"`
+
+	path string
+}
+
+func loadBookmarks() (*bookmarkStore, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	store := &bookmarkStore{path: filepath.Join(dir, "bookmarks.json")}
+
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading bookmarks: %w", err)
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("invalid bookmarks %s: %w", store.path, err)
+	}
+
+	return store, nil
+}
+
+// save replaces the file in one rename, so concurrent krc runs never see it
+// half written.
+func (s *bookmarkStore) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("error saving bookmarks: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".bookmarks-*.json")
+	if err != nil {
+		return fmt.Errorf("error saving bookmarks: %w", err)
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if close_err := tmp.Close(); err == nil {
+		err = close_err
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error saving bookmarks: %w", err)
+	}
+
+	return nil
+}
+
+// remember moves b to the front of the recent list.
+func (s *bookmarkStore) remember(b bookmark) {
+	now := time.Now()
+	b.Time = &now
+
+	recent := []bookmark{b}
+	for _, previous := range s.Recent {
+		previous_key, key := previous, b
+		previous_key.Time, key.Time = nil, nil
+		if previous_key != key && len(recent) < maxRecent {
+			recent = append(recent, previous)
+		}
+	}
+	s.Recent = recent
+}
+
+// recency is the position in the recent list of the first entry match
+// accepts, len(Recent) when there is none.
+func (s *bookmarkStore) recency(match func(bookmark) bool) int {
+	if s == nil {
+		return 0
+	}
+	for i, b := range s.Recent {
+		if match(b) {
+			return i
+		}
+	}
+
+	return len(s.Recent)
+}
+
+// recentBookmarks loads the store for ordering pickers, which go on with
+// their own order when it cannot be read.
+func recentBookmarks() *bookmarkStore {
+	store, err := loadBookmarks()
+	if err != nil {
+		return nil
+	}
+
+	return store
+}
+
+// podPrefix is the part of the pod name its controller keeps across
+// restarts: the deployment name rather than the replica set hash and suffix.
+func podPrefix(pod *v1.Pod) string {
+	if hash := pod.Labels["pod-template-hash"]; hash != "" {
+		if prefix, _, found := strings.Cut(pod.Name, "-"+hash+"-"); found {
+			return prefix + "-"
+		}
+	}
+	if pod.GenerateName != "" {
+		return pod.GenerateName
+	}
+
+	return pod.Name
+}
+
+// expandNamespace resolves the NAMESPACE argument: @NAME is an alias and -
+// the last selection, anything else a namespace name. The bookmark context
+// applies unless --context was given.
+func expandNamespace(arg string, clientOpts *KubeClient.Options) (bookmark, error) {
+	var b bookmark
+	switch {
+	case strings.HasPrefix(arg, "@"):
+		store, err := loadBookmarks()
+		if err != nil {
+			return b, err
+		}
+		alias, found := store.Aliases[arg[1:]]
+		if !found {
+			return b, fmt.Errorf("%w: no alias %s, see ./krc alias ls", KubeClient.ErrNamespaceNotFound, arg)
+		}
+		b = alias
+	case arg == "-":
+		store, err := loadBookmarks()
+		if err != nil {
+			return b, err
+		}
+		if len(store.Recent) == 0 {
+			return b, fmt.Errorf("%w: nothing was selected yet", KubeClient.ErrNamespaceNotFound)
+		}
+		b = store.Recent[0]
+		fmt.Fprintf(os.Stderr, "Using %s\n", b)
+	default:
+		return bookmark{Namespace: arg}, nil
+	}
+
+	if clientOpts.Context == "" {
+		clientOpts.Context = b.Context
+	}
+
+	return b, nil
+}
+
+// applyBookmark fills in the pod and container of b unless the flags chose
+// them already.
+func applyBookmark(b bookmark, sel *podSelection, container *string) {
+	if b.Pod != "" && sel.Pod == "" && sel.labelSelector() == "" && !sel.FirstReady && sel.Index < 0 {
+		sel.Pod = b.Pod
+	}
+	if b.Container != "" && *container == "" {
+		*container = b.Container
+	}
+}
+
+// rememberSelection records a selection in the recent list. Failures only
+// warn, history is a convenience.
+func rememberSelection(client *KubeClient.Client, selected_pod *v1.Pod, container string) {
+	store, err := loadBookmarks()
+	if err == nil {
+		store.remember(bookmark{
+			Context:   client.Context,
+			Namespace: selected_pod.Namespace,
+			Pod:       podPrefix(selected_pod),
+			Container: container,
+		})
+		err = store.save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	}
+}
+
+// recentPodsFirst moves the pods used lately in namespace to the front,
+// most recent first.
+func recentPodsFirst(namespace string, pods []v1.Pod) {
+	store := recentBookmarks()
+	sort.SliceStable(pods, func(i, j int) bool {
+		return podRecency(store, namespace, &pods[i]) < podRecency(store, namespace, &pods[j])
+	})
+}
+
+func podRecency(store *bookmarkStore, namespace string, pod *v1.Pod) int {
+	return store.recency(func(b bookmark) bool {
+		return b.Namespace == namespace && b.Pod != "" && strings.HasPrefix(pod.Name, b.Pod)
+	})
+}
+
+// recentNamespacesFirst moves the namespaces used lately to the front.
+func recentNamespacesFirst(namespaces []v1.Namespace) {
+	store := recentBookmarks()
+	recency := func(name string) int {
+		return store.recency(func(b bookmark) bool { return b.Namespace == name })
+	}
+	sort.SliceStable(namespaces, func(i, j int) bool {
+		return recency(namespaces[i].Name) < recency(namespaces[j].Name)
+	})
+}
+
+// recentContainer is the container last used in a pod like selected_pod.
+func recentContainer(selected_pod *v1.Pod) string {
+	store := recentBookmarks()
+	i := podRecency(store, selected_pod.Namespace, selected_pod)
+	if store == nil || i == len(store.Recent) {
+		return ""
+	}
+
+	return store.Recent[i].Container
+}
+
+func printBookmarks(names []string, bookmarks []bookmark) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tNAMESPACE\tPOD\tCONTAINER\tCONTEXT\tUSED")
+	for i, b := range bookmarks {
+		pod, used := "", ""
+		if b.Pod != "" {
+			pod = b.Pod + "*"
+		}
+		if b.Time != nil {
+			used = b.Time.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", names[i], b.Namespace, pod, b.Container, b.Context, used)
+	}
+	w.Flush()
+}
+
+func aliasCommand(args []string) error {
+	fs := flag.NewFlagSet("alias", flag.ExitOnError)
+	context_name := fs.String("context", "", "kubeconfig context the alias switches to")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc alias add [--context NAME] <ALIAS> <NAMESPACE> [POD_PREFIX [CONTAINER]]")
+		fmt.Fprintln(fs.Output(), "     ./krc alias add <ALIAS> -    saves the last selection")
+		fmt.Fprintln(fs.Output(), "     ./krc alias rm <ALIAS>")
+		fmt.Fprintln(fs.Output(), "     ./krc alias ls")
+		fmt.Fprintln(fs.Output(), "     then use @ALIAS wherever krc takes a NAMESPACE")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	store, err := loadBookmarks()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case action == "add" && fs.NArg() >= 2 && fs.NArg() <= 4:
+		name := strings.TrimPrefix(fs.Arg(0), "@")
+		if !aliasName.MatchString(name) {
+			return fmt.Errorf("invalid alias %q, use letters, digits, '.', '_' and '-'", name)
+		}
+
+		var b bookmark
+		if fs.Arg(1) == "-" {
+			if len(store.Recent) == 0 {
+				return fmt.Errorf("%w: nothing was selected yet", KubeClient.ErrNamespaceNotFound)
+			}
+			b = store.Recent[0]
+			b.Time = nil
+		} else {
+			b = bookmark{Namespace: fs.Arg(1), Pod: fs.Arg(2), Container: fs.Arg(3)}
+		}
+		if *context_name != "" {
+			b.Context = *context_name
+		}
+
+		if store.Aliases == nil {
+			store.Aliases = map[string]bookmark{}
+		}
+		store.Aliases[name] = b
+		if err := store.save(); err != nil {
+			return err
+		}
+		fmt.Printf("@%s is %s\n", name, b)
+
+	case action == "rm" && fs.NArg() == 1:
+		name := strings.TrimPrefix(fs.Arg(0), "@")
+		if _, found := store.Aliases[name]; !found {
+			return fmt.Errorf("%w: no alias @%s", KubeClient.ErrNamespaceNotFound, name)
+		}
+		delete(store.Aliases, name)
+		if err := store.save(); err != nil {
+			return err
+		}
+
+	case action == "ls" && fs.NArg() == 0:
+		names := make([]string, 0, len(store.Aliases))
+		for name := range store.Aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		bookmarks := make([]bookmark, len(names))
+		for i, name := range names {
+			bookmarks[i] = store.Aliases[name]
+			names[i] = "@" + name
+		}
+		printBookmarks(names, bookmarks)
+
+	default:
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+
+	return nil
+}
+
+func recentCommand(args []string) error {
+	fs := flag.NewFlagSet("recent", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc recent")
+		fmt.Fprintln(fs.Output(), "     lists the latest selections, ./krc - reopens the first one")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+
+	store, err := loadBookmarks()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(store.Recent))
+	for i := range names {
+		names[i] = "-"
+		if i > 0 {
+			names[i] = ""
+		}
+	}
+	printBookmarks(names, store.Recent)
+
+	return nil
+}
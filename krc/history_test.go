@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestApplyBookmark(t *testing.T) {
+	alias := bookmark{Namespace: "shop", Pod: "odoo-", Container: "odoo"}
+
+	sel, container := podSelection{Index: -1}, ""
+	applyBookmark(alias, &sel, &container)
+	if sel.Pod != "odoo-" || container != "odoo" {
+		t.Errorf("alias not applied: %+v %q", sel, container)
+	}
+
+	sel, container = podSelection{App: "postgres", Index: -1}, "postgres"
+	applyBookmark(alias, &sel, &container)
+	if sel.Pod != "" || container != "postgres" {
+		t.Errorf("flags should win over the alias: %+v %q", sel, container)
+	}
+
+	sel, container = podSelection{Index: 0}, ""
+	applyBookmark(alias, &sel, &container)
+	if sel.Pod != "" || container != "odoo" {
+		t.Errorf("--index picks among all pods: %+v %q", sel, container)
+	}
+}
@@ -1,54 +1,16 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"log"
 	"os"
-	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
+	"os/signal"
 
-	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/client-go/util/homedir"
-
-	"github.com/v4sr/L0/clipboard"
+	"github.com/v4sr/L0/KubeClient"
 )
 
-func BuildClient() (*rest.Config, *kubernetes.Clientset, error) {
-	var kubeconfig *string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
-
-	restcfg, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	if err != nil {
-		return nil, nil, fmt.Errorf("%w Error building ClientSet config", err)
-	}
-
-	clientset, err := kubernetes.NewForConfig(restcfg)
-	if err != nil {
-		return nil, nil, fmt.Errorf("%w Error creating ClientSet", err)
-	}
-
-	return restcfg, clientset, nil
-}
-
 /*
 	func checkRequiredUtils(basic_req bool) (error) {
 		req_list := [...]string{"xclip","jq"}
@@ -62,242 +24,114 @@ func BuildClient() (*rest.Config, *kubernetes.Clientset, error) {
 	}
 */
 
-func nsExists(clientset kubernetes.Clientset, selected_ns string) (bool, error) {
-	_, err := clientset.CoreV1().Namespaces().Get(context.Background(), selected_ns, metav1.GetOptions{})
-	if err != nil {
-		if errors.IsNotFound(err) {
-			return false, nil
-		}
-
-		return false, fmt.Errorf("%w Error with namespace %s", err, selected_ns)
-	}
-
-	return true, nil
+// fatal reports err and exits with the code scripts rely on to tell missing
+// resources, RBAC denials and unreachable clusters apart. A failed remote
+// command exits silently with its own status, and Ctrl-C with 130 like a
+// shell.
+func fatal(err error) {
+	var exit_err *KubeClient.ExitError
+	switch {
+	case errors.As(err, &exit_err):
+	case errors.Is(err, context.Canceled):
+		os.Exit(130)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+
+	os.Exit(KubeClient.ExitCode(err))
 }
 
-func searchNamespace(clientset kubernetes.Clientset, ilike_ns string) error {
-	namespace_list, err := clientset.CoreV1().Namespaces().List(context.Background(), metav1.GetOptions{})
-	if err != nil {
-		if errors.IsNotFound(err) {
-			return nil
-		}
-
-		return fmt.Errorf("%w Error getting ilike namespace %s", err, ilike_ns)
-	}
-
-	namespace_regex := regexp.MustCompile("(?i)" + regexp.QuoteMeta(ilike_ns))
+// subcommands take over the whole command line when named as first argument.
+var subcommands = map[string]func(args []string) error{
+	"alias":      aliasCommand,
+	"batch":      batchCommand,
+	"fanout":     fanoutCommand,
+	"find":       findCommand,
+	"forward":    forwardCommand,
+	"odoo-shell": odooShellCommand,
+	"psql":       psqlCommand,
+	"recent":     recentCommand,
+	"replay":     replayCommand,
+	"sql":        sqlCommand,
+	"sync":       syncCommand,
+	"tail":       tailCommand,
+}
 
-	var ilike_list []string
-	for _, namespace := range namespace_list.Items {
-		if namespace_regex.MatchString(strings.ToLower(namespace.Name)) {
-			ilike_list = append(ilike_list, namespace.Name)
+func main() {
+	if len(os.Args) > 1 {
+		if command, found := subcommands[os.Args[1]]; found {
+			if err := command(os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
 		}
 	}
 
-	fmt.Printf("REGEX matches for \"%w\"", ilike_ns)
-	for n, namespace := range ilike_list {
-		fmt.Printf("[%d] %s\n", n, namespace)
-	}
-
-	fmt.Printf("Select a Namespace: ")
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("%w Error scanning index", err)
-	}
-
-	selected_ns_index, err := strconv.Atoi(scanner.Text())
-	if err != nil {
-		return fmt.Errorf("%w Error convertig string %s to int", err, scanner.Text())
-	}
-
-	if selected_ns_index < 0 || selected_ns_index >= len(ilike_list) {
-		return fmt.Errorf("Invalid namespace index (out of range [0-%d])", len(ilike_list))
-	}
-
-	selected_ns := string(ilike_list[selected_ns_index])
-	clipboardUtil := clipboard.NewClipboardUtil()
-
-	err = clipboardUtil.Copy(selected_ns)
-	if err != nil {
-		return fmt.Errorf("Error copying to clipboard: %v\n", err)
-	}
-
-	return nil
-}
+	var clientOpts KubeClient.Options
+	var sel podSelection
+	var container string
+	var debug debugSettings
+	var logs logSettings
+	var record recordSettings
+	clientOpts.BindFlags(flag.CommandLine)
+	sel.BindFlags(flag.CommandLine)
+	bindContainerFlags(flag.CommandLine, &container)
+	debug.BindFlags(flag.CommandLine)
+	logs.BindFlags(flag.CommandLine)
+	record.BindFlags(flag.CommandLine)
+	flag.Parse()
 
-func getPo(clientset kubernetes.Clientset, selected_ns string) (*v1.Pod, error) {
-	check, err := nsExists(clientset, selected_ns)
-	if !check || err != nil {
-		return nil, fmt.Errorf("%w Namespace %s non available or existing", err, selected_ns)
+	argsWithoutProg := flag.Args()
+	if len(argsWithoutProg) == 0 {
+		fmt.Fprintln(os.Stderr, "use: ./krc [--kubeconfig PATH] [--context NAME] [--pod NAME] [-l SELECTOR] [--app APP] [--first-ready] [--index N] [-c CONTAINER] [--debug] [--debug-image IMAGE] [--record | --no-record] [LOG FLAGS] <NAMESPACE|@ALIAS|-> [-l | COMMAND...]\n     ./krc find [--regex] [--shell] <PATTERN>\n     ./krc forward <NAMESPACE> [[LOCAL]:REMOTE ...]\n     ./krc tail [-l SELECTOR] [--app APP] [LOG FLAGS] <NAMESPACE>\n     ./krc fanout --ns REGEX [-l SELECTOR] [--workers N] [--json] COMMAND...\n     ./krc replay <FILE.cast>\n     ./krc odoo-shell [--db NAME] <NAMESPACE>\n     ./krc psql [--db NAME] [--odoo] <NAMESPACE> [PSQL ARGS...]\n     ./krc sql [--db NAME] [--dry-run] <NAMESPACE> <FILE.sql>\n     ./krc sync [--dest PATH] [--ignore PATTERN]... [--update MODULES|changed] [--restart] <NAMESPACE> <LOCAL_DIR>\n     ./krc batch [--timeout D] [--continue-on-error] [--json] <NAMESPACE> <RUNBOOK>\n     ./krc alias add|rm|ls ...\n     ./krc recent")
+		os.Exit(KubeClient.ExitUsage)
 	}
 
-	pods, err := clientset.CoreV1().Pods(selected_ns).List(context.Background(), metav1.ListOptions{})
+	selected, err := expandNamespace(argsWithoutProg[0], &clientOpts)
 	if err != nil {
-		return nil, fmt.Errorf("%w Error getting pods from namespace %s", err, selected_ns)
-	}
-
-	fmt.Printf("Pods from %s namespace:\n", selected_ns)
-	for i, pod := range pods.Items {
-		fmt.Printf("[%d] %s\n", i, pod.Name)
-	}
-
-	fmt.Printf("Select a pod: ")
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("%w Error scanning index", err)
+		fatal(err)
 	}
+	applyBookmark(selected, &sel, &container)
+	selected_ns := selected.Namespace
 
-	selectedPodIndex, err := strconv.Atoi(scanner.Text())
+	client, err := KubeClient.NewClient(clientOpts)
 	if err != nil {
-		return nil, fmt.Errorf("%w Error converting string %s to int", err, scanner.Text())
+		fatal(err)
 	}
+	clientset := client.Clientset
 
-	total_pods := len(pods.Items)
-	if selectedPodIndex < 0 || selectedPodIndex >= total_pods {
-		return nil, fmt.Errorf("Invalid pod index (out of range [0-%d])", total_pods)
-	}
-
-	return &pods.Items[selectedPodIndex], nil
-}
-
-func getLogs(clientset kubernetes.Clientset, selected_pod v1.Pod, selected_ns string) (string, error) {
-	count := int64(100)
-	podLogOpts := v1.PodLogOptions{
-		Follow:    true,
-		TailLines: &count,
-	}
-
-	req := clientset.CoreV1().Pods(selected_ns).GetLogs(selected_pod.Name, &podLogOpts)
-	podLogs, err := req.Stream(context.TODO())
+	selected_pod, err := getPo(clientset, selected_ns, sel)
 	if err != nil {
-		return "", fmt.Errorf("%w Error in opening stream", err)
+		fatal(err)
 	}
 
-	defer podLogs.Close()
-
-	for {
-		buf := make([]byte, 2000)
-		numBytes, err := podLogs.Read(buf)
-		if numBytes == 0 {
-			continue
-		}
-		if err == io.EOF {
-			break
-		}
+	logs_mode := len(argsWithoutProg) > 1 && argsWithoutProg[1] == "-l"
+	if !logs_mode || !logs.AllContainers {
+		container, err = getContainer(selected_pod, container, logs_mode)
 		if err != nil {
-			return "", fmt.Errorf("%w Error reading logs", err)
+			fatal(err)
 		}
-		message := string(buf[:numBytes])
-		fmt.Print(message)
 	}
 
-	return "", nil
-}
-
-func executeRemoteCommand(restcfg *rest.Config, clientset kubernetes.Clientset, selected_pod *v1.Pod, command string) (string, string, error) {
-	buf := &bytes.Buffer{}
-	errBuf := &bytes.Buffer{}
+	rememberSelection(client, selected_pod, container)
 
-	if command == "tty" {
-		req := clientset.CoreV1().RESTClient().Post().
-			Resource("pods").
-			Name(selected_pod.Name).
-			Namespace(selected_pod.Namespace).
-			SubResource("exec").
-			VersionedParams(&v1.PodExecOptions{
-				Command: []string{"/bin/bash"},
-				Stdin:   true,
-				Stdout:  true,
-				Stderr:  true,
-				TTY:     true,
-			}, scheme.ParameterCodec)
-
-		exec, err := remotecommand.NewSPDYExecutor(restcfg, "POST", req.URL())
-		if err != nil {
-			return "", "", fmt.Errorf("failed to create executor: %w", err)
-		}
-
-		err = exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{
-			Stdin:  os.Stdin,
-			Stdout: os.Stdout,
-			Stderr: os.Stderr,
-			Tty:    true,
-		})
-		if err != nil {
-			return "", "", fmt.Errorf("failed to execute command: %w", err)
-		}
-
-		return "", "", nil
-	}
-
-	request := clientset.CoreV1().RESTClient().
-		Post().
-		Namespace(selected_pod.Namespace).
-		Resource("pods").
-		Name(selected_pod.Name).
-		SubResource("exec").
-		VersionedParams(&v1.PodExecOptions{
-			Command: []string{"/bin/bash", "-c", command},
-			Stdin:   false,
-			Stdout:  true,
-			Stderr:  true,
-			TTY:     false,
-		}, scheme.ParameterCodec)
-	exec, err := remotecommand.NewSPDYExecutor(restcfg, "POST", request.URL())
-	if err != nil {
-		return "", "", fmt.Errorf("failed to create executor: %w", err)
-	}
-	err = exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{
-		Stdout: buf,
-		Stderr: errBuf,
-	})
-	if err != nil {
-		return "", "", fmt.Errorf("failed executing command: %w", err)
-	}
-
-	return buf.String(), errBuf.String(), nil
-}
-
-func main() {
-	argsWithoutProg := os.Args[1:]
-	if len(argsWithoutProg) == 0 {
-		log.Fatal("use: ./krc <NAMESPACE>")
-	}
-
-	selected_ns := argsWithoutProg[0]
-
-	restcfg, clientset, err := BuildClient()
-	if err != nil {
-		panic(err.Error())
-	}
-
-	selected_pod, err := getPo(*clientset, selected_ns)
-	if err != nil {
-		panic(err.Error())
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
 	if len(argsWithoutProg) == 1 {
-		_, _, err := executeRemoteCommand(restcfg, *clientset, selected_pod, "tty")
+		err := openShell(ctx, client, selected_pod, container, debug, record)
 		if err != nil {
-			panic(err.Error())
+			fatal(err)
 		}
-	} else if argsWithoutProg[1] == "-l" {
-		_, err := getLogs(*clientset, *selected_pod, selected_ns)
+	} else if logs_mode {
+		err := getLogs(ctx, clientset, selected_pod, container, logs)
 		if err != nil {
-			panic(err.Error())
+			fatal(err)
 		}
 	} else {
-		command_buf, command_err, err := executeRemoteCommand(restcfg, *clientset, selected_pod, argsWithoutProg[1])
+		err := runCommand(ctx, client, selected_pod, container, debug, commandLine(argsWithoutProg[1:]))
 		if err != nil {
-			panic(err.Error())
+			fatal(err)
 		}
-
-		if command_err != "" {
-			panic(command_err)
-		}
-
-		fmt.Println(command_buf)
 	}
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// defaultLogTail is how much of the log is shown when neither --tail nor a
+// since flag is given.
+const defaultLogTail = 100
+
+// logSettings mirrors the kubectl logs flags support engineers rely on.
+// Tail is -1 for all lines; TailSet records an explicit --tail, without
+// which --since and --since-time show every line, like kubectl. Raw turns
+// off the record parsing done for terminals.
+type logSettings struct {
+	Since         time.Duration
+	SinceTime     string
+	Previous      bool
+	Timestamps    bool
+	Tail          int64
+	TailSet       bool
+	NoFollow      bool
+	AllContainers bool
+	Output        string
+	Raw           bool
+	Filter        logFilter
+}
+
+func (l *logSettings) BindFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&l.Since, "since", 0, "only logs newer than a relative duration like 5s, 2m or 3h")
+	fs.StringVar(&l.SinceTime, "since-time", "", "only logs after an RFC3339 date, e.g. 2024-06-01T10:00:00Z")
+	fs.BoolVar(&l.Previous, "previous", false, "logs of the previous, crashed instance of the container")
+	fs.BoolVar(&l.Timestamps, "timestamps", false, "prefix every line with its RFC3339 timestamp")
+	l.Tail = defaultLogTail
+	fs.Func("tail", fmt.Sprintf("lines of recent log to show, -1 for all (default %d, all with --since or --since-time)", defaultLogTail), func(value string) error {
+		tail, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		l.Tail, l.TailSet = tail, true
+		return nil
+	})
+	fs.BoolVar(&l.NoFollow, "no-follow", false, "print the logs and exit instead of following them")
+	fs.BoolVar(&l.AllContainers, "all-containers", false, "logs of every container in the pod, init containers included")
+	fs.StringVar(&l.Output, "output", "", "write the logs to this file instead of stdout")
+	fs.BoolVar(&l.Raw, "raw", false, "print lines as they come, without grouping tracebacks or highlighting errors")
+	l.Filter.BindFlags(fs)
+}
+
+func (l logSettings) podLogOptions(container string) (*v1.PodLogOptions, error) {
+	if err := l.Filter.validate(); err != nil {
+		return nil, err
+	}
+	if l.Raw && l.Filter.enabled() {
+		return nil, fmt.Errorf("--raw cannot be combined with --level, --db, --logger or --json")
+	}
+
+	opts := &v1.PodLogOptions{
+		Container:  container,
+		Follow:     !l.NoFollow && !l.Previous,
+		Previous:   l.Previous,
+		Timestamps: l.Timestamps,
+	}
+
+	if l.Tail >= 0 && (l.TailSet || (l.Since == 0 && l.SinceTime == "")) {
+		tail := l.Tail
+		opts.TailLines = &tail
+	}
+
+	switch {
+	case l.Since != 0 && l.SinceTime != "":
+		return nil, fmt.Errorf("--since and --since-time are mutually exclusive")
+	case l.Since != 0:
+		seconds := int64(l.Since.Round(time.Second).Seconds())
+		opts.SinceSeconds = &seconds
+	case l.SinceTime != "":
+		since, err := time.Parse(time.RFC3339, l.SinceTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --since-time %q: %w", l.SinceTime, err)
+		}
+		opts.SinceTime = &metav1.Time{Time: since}
+	}
+
+	return opts, nil
+}
+
+// lineWriter serializes whole lines from concurrent log streams. colors is
+// set when w is a terminal that honours ANSI colors.
+type lineWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	colors bool
+}
+
+func (lw *lineWriter) WriteLine(prefix string, line string) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	_, err := io.WriteString(lw.w, prefix+line)
+	return err
+}
+
+// logSink receives a container log line by line. Flush is called once the
+// stream ends.
+type logSink interface {
+	Line(line string) error
+	Flush() error
+}
+
+type plainSink struct {
+	out    *lineWriter
+	prefix string
+}
+
+func (s plainSink) Line(line string) error {
+	return s.out.WriteLine(s.prefix, line)
+}
+
+func (s plainSink) Flush() error {
+	return nil
+}
+
+// sink returns where the lines of container go: through the record parser
+// when filtering or JSON output is on, or when out is a terminal, where
+// tracebacks are kept together and errors highlighted; straight to out for
+// pipes, files and --raw.
+func (l logSettings) sink(out *lineWriter, selected_pod *v1.Pod, container string, prefix string) logSink {
+	if !l.Filter.enabled() && (l.Raw || !out.colors) {
+		return plainSink{out: out, prefix: prefix}
+	}
+
+	return newRecordSink(out, l.Filter, selected_pod.Name, container, prefix)
+}
+
+// streamLogs feeds a container log to sink line by line until the stream
+// ends or ctx is cancelled.
+func streamLogs(ctx context.Context, clientset kubernetes.Interface, selected_pod *v1.Pod, opts *v1.PodLogOptions, sink logSink) error {
+	req := clientset.CoreV1().Pods(selected_pod.Namespace).GetLogs(selected_pod.Name, opts)
+	podLogs, err := req.Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("error opening log stream of %s/%s: %w", selected_pod.Name, opts.Container, KubeClient.Classify(err))
+	}
+	defer podLogs.Close()
+	defer sink.Flush()
+
+	reader := bufio.NewReader(podLogs)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] != '\n' {
+				line += "\n"
+			}
+			if err := sink.Line(line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading logs of %s/%s: %w", selected_pod.Name, opts.Container, err)
+		}
+	}
+}
+
+// openLogOutput returns the writer selected by --output, stdout by default,
+// and the function that closes it.
+func openLogOutput(settings logSettings, what string) (*lineWriter, func(), error) {
+	if settings.Output == "" {
+		colors := os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+		return &lineWriter{w: os.Stdout, colors: colors}, func() {}, nil
+	}
+
+	f, err := os.Create(settings.Output)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating log output file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Writing logs of %s to %s\n", what, settings.Output)
+
+	return &lineWriter{w: f}, func() { f.Close() }, nil
+}
+
+func getLogs(ctx context.Context, clientset kubernetes.Interface, selected_pod *v1.Pod, container string, settings logSettings) error {
+	out, closeOutput, err := openLogOutput(settings, selected_pod.Name)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if !settings.AllContainers {
+		opts, err := settings.podLogOptions(container)
+		if err != nil {
+			return err
+		}
+		return streamLogs(ctx, clientset, selected_pod, opts, settings.sink(out, selected_pod, container, ""))
+	}
+
+	var containers []string
+	for _, c := range selected_pod.Spec.InitContainers {
+		containers = append(containers, c.Name)
+	}
+	for _, c := range selected_pod.Spec.Containers {
+		containers = append(containers, c.Name)
+	}
+
+	errs := make([]error, len(containers))
+	var wg sync.WaitGroup
+	for i, name := range containers {
+		opts, err := settings.podLogOptions(name)
+		if err != nil {
+			return err
+		}
+
+		sink := settings.sink(out, selected_pod, name, "["+name+"] ")
+		if !opts.Follow {
+			errs[i] = streamLogs(ctx, clientset, selected_pod, opts, sink)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = streamLogs(ctx, clientset, selected_pod, opts, sink)
+		}(i)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
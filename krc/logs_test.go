@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// optional is -1 for an unset option.
+func optional(value *int64) int64 {
+	if value == nil {
+		return -1
+	}
+
+	return *value
+}
+
+func TestPodLogOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings logSettings
+		tail     int64
+		since    int64
+		follow   bool
+	}{
+		{"default tail", logSettings{Tail: defaultLogTail}, defaultLogTail, -1, true},
+		{"since shows all", logSettings{Tail: defaultLogTail, Since: 90 * time.Second}, -1, 90, true},
+		{"explicit tail with since", logSettings{Tail: 5, TailSet: true, Since: time.Minute}, 5, 60, true},
+		{"all lines", logSettings{Tail: -1, TailSet: true}, -1, -1, true},
+		{"previous does not follow", logSettings{Tail: defaultLogTail, Previous: true}, defaultLogTail, -1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := test.settings.podLogOptions("odoo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.Container != "odoo" || opts.Follow != test.follow {
+				t.Errorf("container %q, follow %v", opts.Container, opts.Follow)
+			}
+			if tail := optional(opts.TailLines); tail != test.tail {
+				t.Errorf("TailLines = %d, want %d", tail, test.tail)
+			}
+			if since := optional(opts.SinceSeconds); since != test.since {
+				t.Errorf("SinceSeconds = %d, want %d", since, test.since)
+			}
+		})
+	}
+}
+
+func TestPodLogOptionsRejects(t *testing.T) {
+	for name, settings := range map[string]logSettings{
+		"since and since-time": {Since: time.Minute, SinceTime: "2024-06-01T10:00:00Z"},
+		"bad since-time":       {SinceTime: "yesterday"},
+		"bad level":            {Filter: logFilter{Level: "LOUD"}},
+		"raw and json":         {Raw: true, Filter: logFilter{JSON: true}},
+	} {
+		if _, err := settings.podLogOptions("odoo"); err == nil {
+			t.Errorf("%s should be rejected", name)
+		}
+	}
+}
+
+func TestLogSink(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "odoo-0"}}
+	terminal := &lineWriter{w: io.Discard, colors: true}
+	pipe := &lineWriter{w: io.Discard}
+
+	tests := []struct {
+		name     string
+		settings logSettings
+		out      *lineWriter
+		parsed   bool
+	}{
+		{"terminal", logSettings{}, terminal, true},
+		{"terminal with --raw", logSettings{Raw: true}, terminal, false},
+		{"pipe", logSettings{}, pipe, false},
+		{"pipe with a filter", logSettings{Filter: logFilter{Level: "error"}}, pipe, true},
+	}
+	for _, test := range tests {
+		_, parsed := test.settings.sink(test.out, pod, "odoo", "").(*recordSink)
+		if parsed != test.parsed {
+			t.Errorf("%s: parsed = %v, want %v", test.name, parsed, test.parsed)
+		}
+	}
+}
+
+func TestRecordSinkHighlightsTracebacks(t *testing.T) {
+	var buf bytes.Buffer
+	sink := newRecordSink(&lineWriter{w: &buf, colors: true}, logFilter{}, "odoo-0", "odoo", "")
+	for _, line := range []string{
+		"2024-06-01 10:00:00,123 42 ERROR shop odoo.http: Exception during request handling.\n",
+		"Traceback (most recent call last):\n",
+		"ValueError: boom\n",
+		"2024-06-01 10:00:01,000 42 INFO shop werkzeug: GET / 200\n",
+	} {
+		if err := sink.Line(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.Flush()
+
+	want := "\x1b[31m2024-06-01 10:00:00,123 42 ERROR shop odoo.http: Exception during request handling.\x1b[0m\n" +
+		"\x1b[31mTraceback (most recent call last):\x1b[0m\n" +
+		"\x1b[31mValueError: boom\x1b[0m\n" +
+		"2024-06-01 10:00:01,000 42 INFO shop werkzeug: GET / 200\n"
+	if buf.String() != want {
+		t.Errorf("output:\n%q\nwant:\n%q", buf.String(), want)
+	}
+}
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// odooConfPaths are tried in order when ODOO_RC is not set in the container.
+var odooConfPaths = []string{"/etc/odoo/odoo.conf", "/etc/odoo/openerp-server.conf", "/etc/odoo.conf"}
+
+// dbCredentials is how a container reaches the tenant database. An empty
+// Host means the local socket.
+type dbCredentials struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Database string
+	// Config is the odoo.conf found in the Odoo container.
+	Config string
+}
+
+func imageHas(container v1.Container, word string) bool {
+	return strings.Contains(strings.ToLower(container.Image), word)
+}
+
+// containerWith returns the first container whose image mentions word, ""
+// when there is none.
+func containerWith(pod *v1.Pod, word string) string {
+	for _, container := range pod.Spec.Containers {
+		if imageHas(container, word) {
+			return container.Name
+		}
+	}
+
+	return ""
+}
+
+func isOdooPod(pod *v1.Pod) bool {
+	return containerWith(pod, "odoo") != ""
+}
+
+func isPostgresPod(pod *v1.Pod) bool {
+	return containerWith(pod, "postgres") != "" || containerWith(pod, "postgis") != ""
+}
+
+// findPod picks a pod with getPo, limited to those keep accepts unless the
+// selection flags already name one.
+func findPod(clientset kubernetes.Interface, selected_ns string, sel podSelection, kind string, keep func(*v1.Pod) bool) (*v1.Pod, error) {
+	if sel.Pod != "" || sel.labelSelector() != "" {
+		keep = nil
+	}
+
+	return getPoMatching(clientset, selected_ns, sel, kind+" ", keep)
+}
+
+// containerEnv resolves the environment of container, following the Secret
+// and ConfigMap references of env and envFrom.
+func containerEnv(ctx context.Context, clientset kubernetes.Interface, pod *v1.Pod, container string) (map[string]string, error) {
+	secrets := map[string]map[string][]byte{}
+	getSecret := func(name string) (map[string][]byte, error) {
+		if data, found := secrets[name]; found {
+			return data, nil
+		}
+		secret, err := clientset.CoreV1().Secrets(pod.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error reading secret %s/%s: %w", pod.Namespace, name, KubeClient.Classify(err))
+		}
+		secrets[name] = secret.Data
+		return secret.Data, nil
+	}
+
+	config_maps := map[string]map[string]string{}
+	getConfigMap := func(name string) (map[string]string, error) {
+		if data, found := config_maps[name]; found {
+			return data, nil
+		}
+		cm, err := clientset.CoreV1().ConfigMaps(pod.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error reading config map %s/%s: %w", pod.Namespace, name, KubeClient.Classify(err))
+		}
+		config_maps[name] = cm.Data
+		return cm.Data, nil
+	}
+
+	optional := func(flag *bool) bool {
+		return flag != nil && *flag
+	}
+
+	env := map[string]string{}
+	for _, c := range pod.Spec.Containers {
+		if c.Name != container {
+			continue
+		}
+
+		for _, from := range c.EnvFrom {
+			switch {
+			case from.SecretRef != nil:
+				data, err := getSecret(from.SecretRef.Name)
+				if err != nil && !optional(from.SecretRef.Optional) {
+					return nil, err
+				}
+				for key, value := range data {
+					env[from.Prefix+key] = string(value)
+				}
+			case from.ConfigMapRef != nil:
+				data, err := getConfigMap(from.ConfigMapRef.Name)
+				if err != nil && !optional(from.ConfigMapRef.Optional) {
+					return nil, err
+				}
+				for key, value := range data {
+					env[from.Prefix+key] = value
+				}
+			}
+		}
+
+		for _, variable := range c.Env {
+			switch {
+			case variable.ValueFrom == nil:
+				env[variable.Name] = variable.Value
+			case variable.ValueFrom.SecretKeyRef != nil:
+				ref := variable.ValueFrom.SecretKeyRef
+				data, err := getSecret(ref.Name)
+				if err != nil && !optional(ref.Optional) {
+					return nil, err
+				}
+				if value, found := data[ref.Key]; found {
+					env[variable.Name] = string(value)
+				}
+			case variable.ValueFrom.ConfigMapKeyRef != nil:
+				ref := variable.ValueFrom.ConfigMapKeyRef
+				data, err := getConfigMap(ref.Name)
+				if err != nil && !optional(ref.Optional) {
+					return nil, err
+				}
+				if value, found := data[ref.Key]; found {
+					env[variable.Name] = value
+				}
+			}
+		}
+	}
+
+	return env, nil
+}
+
+func firstEnv(env map[string]string, names ...string) string {
+	for _, name := range names {
+		if value := env[name]; value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// parseOdooConf returns the [options] of an odoo.conf, "False" values
+// dropped.
+func parseOdooConf(data string) map[string]string {
+	options := map[string]string{}
+	section := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		case section == "options":
+			key, value, found := strings.Cut(line, "=")
+			if !found {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if strings.EqualFold(value, "false") {
+				value = ""
+			}
+			options[strings.TrimSpace(key)] = value
+		}
+	}
+
+	return options
+}
+
+// readOdooConf returns the path and [options] of the first readable
+// odoo.conf in the container, "" when there is none.
+func readOdooConf(ctx context.Context, client *KubeClient.Client, pod *v1.Pod, container string, env map[string]string) (string, map[string]string, error) {
+	paths := odooConfPaths
+	if rc := env["ODOO_RC"]; rc != "" {
+		paths = append([]string{rc}, paths...)
+	}
+
+	script := `for f in "$@"; do if [ -r "$f" ]; then echo "$f"; exec cat "$f"; fi; done; exit 3`
+	stdout, _, err := KubeClient.Run(ctx, client.Executor, KubeClient.ExecOptions{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Command:   append([]string{"sh", "-c", script, "sh"}, paths...),
+		ReadOnly:  true,
+	})
+
+	var exit_err *KubeClient.ExitError
+	if errors.As(err, &exit_err) && exit_err.Code == 3 {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading odoo.conf: %w", err)
+	}
+
+	path, data, _ := strings.Cut(stdout, "\n")
+	return path, parseOdooConf(data), nil
+}
+
+// odooCredentials resolves the database settings of an Odoo container the
+// way Odoo does: odoo.conf first, overridden by the HOST, PORT, USER and
+// PASSWORD variables the official image turns into command line options.
+func odooCredentials(ctx context.Context, client *KubeClient.Client, pod *v1.Pod, container string) (dbCredentials, error) {
+	var creds dbCredentials
+
+	env, err := containerEnv(ctx, client.Clientset, pod, container)
+	if err != nil {
+		return creds, err
+	}
+
+	path, conf, err := readOdooConf(ctx, client, pod, container, env)
+	if err != nil {
+		return creds, err
+	}
+	creds = dbCredentials{
+		Host:     conf["db_host"],
+		Port:     conf["db_port"],
+		User:     conf["db_user"],
+		Password: conf["db_password"],
+		Database: conf["db_name"],
+		Config:   path,
+	}
+
+	if host := firstEnv(env, "HOST", "DB_HOST", "PGHOST"); host != "" {
+		creds.Host = host
+	}
+	if port := firstEnv(env, "PORT", "DB_PORT", "PGPORT"); port != "" {
+		if _, err := strconv.Atoi(port); err == nil {
+			creds.Port = port
+		}
+	}
+	if user := firstEnv(env, "USER", "DB_USER", "PGUSER"); user != "" {
+		creds.User = user
+	}
+	if password := firstEnv(env, "PASSWORD", "DB_PASSWORD", "PGPASSWORD"); password != "" {
+		creds.Password = password
+	}
+	if database := firstEnv(env, "DB_NAME", "PGDATABASE"); database != "" {
+		creds.Database = database
+	}
+
+	// db_name may list several databases or be a filter pattern.
+	if strings.ContainsAny(creds.Database, ",*%^$") {
+		creds.Database = ""
+	}
+
+	return creds, nil
+}
+
+// postgresCredentials reads the superuser of an official Postgres container,
+// reached on the local socket.
+func postgresCredentials(ctx context.Context, client *KubeClient.Client, pod *v1.Pod, container string) (dbCredentials, error) {
+	env, err := containerEnv(ctx, client.Clientset, pod, container)
+	if err != nil {
+		return dbCredentials{}, err
+	}
+
+	creds := dbCredentials{
+		User:     firstEnv(env, "POSTGRES_USER", "POSTGRESQL_USERNAME", "PGUSER"),
+		Password: firstEnv(env, "POSTGRES_PASSWORD", "POSTGRESQL_PASSWORD", "PGPASSWORD"),
+	}
+	if creds.User == "" {
+		creds.User = "postgres"
+	}
+
+	return creds, nil
+}
+
+// stagePassword writes a pgpass file for password in the container and
+// returns its path. The password goes through stdin, so it never shows in a
+// command line, the process list or the audit log.
+func stagePassword(ctx context.Context, client *KubeClient.Client, pod *v1.Pod, container string, password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `:`, `\:`).Replace(password)
+	stdout, _, err := KubeClient.Run(ctx, client.Executor, KubeClient.ExecOptions{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Command:   []string{"sh", "-c", `umask 077 && f=$(mktemp) && cat > "$f" && echo "$f"`},
+		Stdin:     strings.NewReader("*:*:*:*:" + escaped + "\n"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error passing the database password to the container: %w", err)
+	}
+
+	return strings.TrimSpace(stdout), nil
+}
+
+// withPassFile runs argv with PGPASSFILE set to pass_file, removing the
+// file afterwards when remove is set.
+func withPassFile(pass_file string, remove bool, argv []string) []string {
+	if pass_file == "" {
+		return argv
+	}
+
+	script := `export PGPASSFILE="$0"; exec "$@"`
+	if remove {
+		script = `export PGPASSFILE="$0"; "$@"; status=$?; rm -f "$0"; exit $status`
+	}
+
+	return append([]string{"sh", "-c", script, pass_file}, argv...)
+}
+
+// psqlArgs are the connection options of psql for creds.
+func psqlArgs(creds dbCredentials) []string {
+	var args []string
+	if creds.Host != "" {
+		args = append(args, "-h", creds.Host)
+	}
+	if creds.Port != "" {
+		args = append(args, "-p", creds.Port)
+	}
+	if creds.User != "" {
+		args = append(args, "-U", creds.User)
+	}
+
+	return args
+}
+
+// chooseDatabase lists the databases creds can reach and lets the user pick
+// one.
+func chooseDatabase(ctx context.Context, client *KubeClient.Client, pod *v1.Pod, container string, creds dbCredentials, pass_file string) (string, error) {
+	query := "SELECT datname FROM pg_database WHERE NOT datistemplate AND datname <> 'postgres' ORDER BY datname"
+	argv := append(append([]string{"psql"}, psqlArgs(creds)...), "-d", "postgres", "-Atc", query)
+
+	stdout, stderr, err := KubeClient.Run(ctx, client.Executor, KubeClient.ExecOptions{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Command:   withPassFile(pass_file, false, argv),
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error listing databases, pass --db: %w: %s", err, strings.TrimSpace(stderr))
+	}
+
+	databases := strings.Fields(stdout)
+	switch len(databases) {
+	case 0:
+		return "", fmt.Errorf("no databases found, pass --db")
+	case 1:
+		return databases[0], nil
+	}
+
+	items := make([]KubeClient.PickerItem, len(databases))
+	for i, name := range databases {
+		items[i] = KubeClient.PickerItem{Name: name}
+	}
+	i, err := KubeClient.Picker{Prompt: "Database in " + pod.Namespace, Header: []string{"DATABASE"}, Items: items}.Run()
+	if errors.Is(err, KubeClient.ErrNoTerminal) {
+		return "", fmt.Errorf("%d databases found, pass one with --db", len(databases))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return databases[i], nil
+}
+
+// dbTarget is the pod, container and credentials a database command runs
+// with.
+type dbTarget struct {
+	pod       *v1.Pod
+	container string
+	creds     dbCredentials
+	pass_file string
+}
+
+// odooContainer finds the Odoo pod of the namespace and the container
+// running Odoo in it.
+func odooContainer(clientset kubernetes.Interface, selected_ns string, sel podSelection, container string) (*v1.Pod, string, error) {
+	pod, err := findPod(clientset, selected_ns, sel, "Odoo", isOdooPod)
+	if err != nil {
+		return nil, "", err
+	}
+	if container == "" {
+		container = containerWith(pod, "odoo")
+	}
+	if container == "" {
+		container = defaultContainer(pod)
+	}
+
+	return pod, container, nil
+}
+
+// resolveOdoo finds the Odoo container of the namespace and its database
+// settings.
+func resolveOdoo(ctx context.Context, client *KubeClient.Client, selected_ns string, sel podSelection, container string) (*dbTarget, error) {
+	pod, container, err := odooContainer(client.Clientset, selected_ns, sel, container)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := odooCredentials(ctx, client, pod, container)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbTarget{pod: pod, container: container, creds: creds}, nil
+}
+
+func (t *dbTarget) prepare(ctx context.Context, client *KubeClient.Client, database string) error {
+	if err := client.Guard.Check(ctx, t.pod.Namespace); err != nil {
+		return err
+	}
+
+	pass_file, err := stagePassword(ctx, client, t.pod, t.container, t.creds.Password)
+	if err != nil {
+		return err
+	}
+	t.pass_file = pass_file
+
+	if database != "" {
+		t.creds.Database = database
+	}
+	if t.creds.Database == "" {
+		t.creds.Database, err = chooseDatabase(ctx, client, t.pod, t.container, t.creds, pass_file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanup removes the staged pgpass file. withPassFile already removes it
+// once the session ran, so callers defer it before prepare for sessions that
+// never started.
+func (t *dbTarget) cleanup(client *KubeClient.Client) {
+	if t.pass_file == "" {
+		return
+	}
+
+	KubeClient.Run(context.Background(), client.Executor, KubeClient.ExecOptions{
+		Namespace: t.pod.Namespace,
+		Pod:       t.pod.Name,
+		Container: t.container,
+		Command:   []string{"rm", "-f", t.pass_file},
+	})
+}
+
+func dbFlags(fs *flag.FlagSet, clientOpts *KubeClient.Options, sel *podSelection, container *string, record *recordSettings) *string {
+	clientOpts.BindFlags(fs)
+	sel.BindFlags(fs)
+	bindContainerFlags(fs, container)
+	record.BindFlags(fs)
+
+	return fs.String("db", "", "database to open, asked for when there are several")
+}
+
+// odooArgs builds an odoo command line reaching the database in creds. The
+// password comes from the staged pgpass file, see withPassFile: an empty
+// --db_password overrides the one of odoo.conf, which may not be the one
+// creds resolved, and Odoo leaves an empty password to libpq.
+func odooArgs(odoo_bin string, creds dbCredentials, command ...string) []string {
+	argv := append([]string{odoo_bin}, command...)
+	argv = append(argv, "-d", creds.Database)
+	if creds.Config != "" {
+		argv = append(argv, "-c", creds.Config)
+	}
+	argv = append(argv, "--db_password=")
+	if creds.Host != "" {
+		argv = append(argv, "--db_host", creds.Host)
+	}
+	if creds.Port != "" {
+		argv = append(argv, "--db_port", creds.Port)
+	}
+	if creds.User != "" {
+		argv = append(argv, "-r", creds.User)
+	}
+
+	return argv
+}
+
+func odooShellCommand(args []string) error {
+	var clientOpts KubeClient.Options
+	var sel podSelection
+	var container string
+	var record recordSettings
+	fs := flag.NewFlagSet("odoo-shell", flag.ExitOnError)
+	database := dbFlags(fs, &clientOpts, &sel, &container, &record)
+	odoo_bin := fs.String("odoo-bin", "odoo", "Odoo executable in the container, e.g. odoo-bin for source installs")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc odoo-shell [POD SELECTION FLAGS] [-c CONTAINER] [--db NAME] [--odoo-bin PATH] <NAMESPACE>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+	selected, err := expandNamespace(fs.Arg(0), &clientOpts)
+	if err != nil {
+		return err
+	}
+	applyBookmark(selected, &sel, &container)
+	selected_ns := selected.Namespace
+
+	client, err := KubeClient.NewClient(clientOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	target, err := resolveOdoo(ctx, client, selected_ns, sel, container)
+	if err != nil {
+		return err
+	}
+	defer target.cleanup(client)
+	if err := target.prepare(ctx, client, *database); err != nil {
+		return err
+	}
+
+	argv := odooArgs(*odoo_bin, target.creds, "shell")
+
+	fmt.Fprintf(os.Stderr, "Odoo shell on %s in %s/%s\n", target.creds.Database, target.pod.Name, target.container)
+	return runInteractive(ctx, client, target.pod, KubeClient.ExecOptions{
+		Namespace: target.pod.Namespace,
+		Pod:       target.pod.Name,
+		Container: target.container,
+		Command:   withPassFile(target.pass_file, true, argv),
+	}, record)
+}
+
+func psqlCommand(args []string) error {
+	var clientOpts KubeClient.Options
+	var sel podSelection
+	var container string
+	var record recordSettings
+	fs := flag.NewFlagSet("psql", flag.ExitOnError)
+	database := dbFlags(fs, &clientOpts, &sel, &container, &record)
+	from_odoo := fs.Bool("odoo", false, "run psql in the Odoo pod with its credentials even if there is a Postgres pod")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc psql [POD SELECTION FLAGS] [-c CONTAINER] [--db NAME] [--odoo] <NAMESPACE> [PSQL ARGS...]")
+		fmt.Fprintln(fs.Output(), "     runs in the Postgres pod of the namespace, or in the Odoo pod when there is none")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+	selected, err := expandNamespace(fs.Arg(0), &clientOpts)
+	if err != nil {
+		return err
+	}
+	applyBookmark(selected, &sel, &container)
+	selected_ns := selected.Namespace
+
+	client, err := KubeClient.NewClient(clientOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	target, err := resolvePsql(ctx, client, selected_ns, sel, container, *from_odoo)
+	if err != nil {
+		return err
+	}
+	defer target.cleanup(client)
+	if err := target.prepare(ctx, client, *database); err != nil {
+		return err
+	}
+
+	argv := append(append([]string{"psql"}, psqlArgs(target.creds)...), "-d", target.creds.Database)
+	argv = append(argv, fs.Args()[1:]...)
+
+	return runInteractive(ctx, client, target.pod, KubeClient.ExecOptions{
+		Namespace: target.pod.Namespace,
+		Pod:       target.pod.Name,
+		Container: target.container,
+		Command:   withPassFile(target.pass_file, true, argv),
+	}, record)
+}
+
+// resolvePsql prefers the Postgres pod of the namespace, where the
+// superuser reaches every database, and falls back to the Odoo pod.
+func resolvePsql(ctx context.Context, client *KubeClient.Client, selected_ns string, sel podSelection, container string, from_odoo bool) (*dbTarget, error) {
+	if from_odoo {
+		return resolveOdoo(ctx, client, selected_ns, sel, container)
+	}
+
+	pod, err := findPod(client.Clientset, selected_ns, sel, "Postgres", isPostgresPod)
+	if errors.Is(err, KubeClient.ErrPodNotFound) && sel.Pod == "" && sel.labelSelector() == "" {
+		return resolveOdoo(ctx, client, selected_ns, sel, container)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isPostgresPod(pod) {
+		return resolveOdoo(ctx, client, selected_ns, podSelection{Pod: pod.Name, Index: -1}, container)
+	}
+
+	if container == "" {
+		container = containerWith(pod, "postgres")
+	}
+	if container == "" {
+		container = containerWith(pod, "postgis")
+	}
+
+	creds, err := postgresCredentials(ctx, client, pod, container)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbTarget{pod: pod, container: container, creds: creds}, nil
+}
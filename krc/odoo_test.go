@@ -0,0 +1,19 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOdooArgs(t *testing.T) {
+	creds := dbCredentials{Host: "db", Port: "5432", User: "odoo", Password: "secret", Database: "shop", Config: "/etc/odoo/odoo.conf"}
+
+	got := strings.Join(odooArgs("odoo", creds, "shell"), " ")
+	want := "odoo shell -d shop -c /etc/odoo/odoo.conf --db_password= --db_host db --db_port 5432 -r odoo"
+	if got != want {
+		t.Errorf("odooArgs = %s, want %s", got, want)
+	}
+	if strings.Contains(got, creds.Password) {
+		t.Error("the password must not be on the command line")
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordIdle is how long a record waits for continuation lines before it is
+// printed, so the last traceback of a quiet pod still shows up when
+// following.
+const recordIdle = 500 * time.Millisecond
+
+var (
+	// kubeTimestamp is the prefix added by --timestamps.
+	kubeTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\S+Z `)
+	// odooLine matches "2024-06-01 10:00:00,123 42 INFO db odoo.modules.loading: message".
+	odooLine = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3}) (\d+) (DEBUG|INFO|WARNING|ERROR|CRITICAL) (\S+) ([^\s:]+): ?(.*)$`)
+	// postgresLine matches the default "%m [%p] " prefix, with an optional
+	// "%q%u@%d " after it: "2024-06-01 10:00:00.123 UTC [42] odoo@db ERROR:  message".
+	postgresLine = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?(?: [A-Z]+)?) \[(\d+)\](?:-\d+)? (?:(\S*)@(\S*) )?([A-Z0-9]+):  ?(.*)$`)
+)
+
+// levelRank orders Odoo and PostgreSQL levels on a single scale.
+var levelRank = map[string]int{
+	"DEBUG": 10, "DEBUG1": 10, "DEBUG2": 10, "DEBUG3": 10, "DEBUG4": 10, "DEBUG5": 10,
+	"INFO": 20, "LOG": 20, "NOTICE": 20,
+	"WARNING":  30,
+	"ERROR":    40,
+	"CRITICAL": 50, "FATAL": 50, "PANIC": 50,
+}
+
+// postgresDetails are the PostgreSQL lines that belong to the record before
+// them.
+var postgresDetails = map[string]bool{
+	"DETAIL": true, "HINT": true, "STATEMENT": true, "CONTEXT": true, "QUERY": true, "LOCATION": true,
+}
+
+// logFilter selects parsed records by level, database and logger.
+type logFilter struct {
+	Level    string
+	Database string
+	Logger   string
+	JSON     bool
+}
+
+func (f *logFilter) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.Level, "level", "", "only Odoo/PostgreSQL records at or above this level, e.g. warning")
+	fs.StringVar(&f.Database, "db", "", "only records of this database")
+	fs.StringVar(&f.Logger, "logger", "", "only records whose logger starts with this, e.g. odoo.addons.sale")
+	fs.BoolVar(&f.JSON, "json", false, "print parsed records as JSON lines")
+}
+
+func (f logFilter) enabled() bool {
+	return f.Level != "" || f.Database != "" || f.Logger != "" || f.JSON
+}
+
+func (f logFilter) validate() error {
+	if f.Level != "" {
+		if _, found := levelRank[strings.ToUpper(f.Level)]; !found {
+			return fmt.Errorf("unknown --level %q, use debug, info, warning, error or critical", f.Level)
+		}
+	}
+
+	return nil
+}
+
+func (f logFilter) match(r *logRecord) bool {
+	if r.Format == "raw" {
+		return f.Level == "" && f.Database == "" && f.Logger == ""
+	}
+	if f.Level != "" && levelRank[r.Level] < levelRank[strings.ToUpper(f.Level)] {
+		return false
+	}
+	if f.Database != "" && r.Database != f.Database {
+		return false
+	}
+	if f.Logger != "" && !strings.HasPrefix(r.Logger, f.Logger) {
+		return false
+	}
+
+	return true
+}
+
+// logRecord is one Odoo or PostgreSQL log entry. Tracebacks and PostgreSQL
+// DETAIL/STATEMENT lines are folded into the record that raised them.
+type logRecord struct {
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Format    string `json:"format"`
+	Time      string `json:"time,omitempty"`
+	PID       int    `json:"pid,omitempty"`
+	Level     string `json:"level,omitempty"`
+	Database  string `json:"db,omitempty"`
+	User      string `json:"user,omitempty"`
+	Logger    string `json:"logger,omitempty"`
+	Message   string `json:"message"`
+	Traceback string `json:"traceback,omitempty"`
+
+	lines []string
+}
+
+// parseLogLine returns the record started by line, or nil when line
+// continues the previous one.
+func parseLogLine(line string) *logRecord {
+	text := kubeTimestamp.ReplaceAllString(line, "")
+
+	if m := odooLine.FindStringSubmatch(text); m != nil {
+		pid, _ := strconv.Atoi(m[2])
+		db := m[4]
+		if db == "?" {
+			db = ""
+		}
+		return &logRecord{Format: "odoo", Time: m[1], PID: pid, Level: m[3], Database: db, Logger: m[5], Message: m[6]}
+	}
+
+	if m := postgresLine.FindStringSubmatch(text); m != nil {
+		if postgresDetails[m[5]] {
+			return nil
+		}
+		pid, _ := strconv.Atoi(m[2])
+		return &logRecord{Format: "postgres", Time: m[1], PID: pid, User: m[3], Database: m[4], Level: m[5], Logger: "postgres", Message: m[6]}
+	}
+
+	return nil
+}
+
+// recordSink groups the lines of one container into records and prints the
+// ones the filter lets through.
+type recordSink struct {
+	out       *lineWriter
+	filter    logFilter
+	pod       string
+	container string
+	prefix    string
+
+	mu      sync.Mutex
+	pending *logRecord
+	timer   *time.Timer
+}
+
+func newRecordSink(out *lineWriter, filter logFilter, pod string, container string, prefix string) *recordSink {
+	return &recordSink{out: out, filter: filter, pod: pod, container: container, prefix: prefix}
+}
+
+func (s *recordSink) Line(line string) error {
+	line = strings.TrimRight(line, "\r\n")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := parseLogLine(line)
+	switch {
+	case record != nil:
+		if err := s.flushLocked(); err != nil {
+			return err
+		}
+		s.pending = record
+	case s.pending == nil:
+		s.pending = &logRecord{Format: "raw", Message: line}
+	case s.pending.Format == "raw":
+		// Unparsed lines have nothing to attach to, keep them apart.
+		if err := s.flushLocked(); err != nil {
+			return err
+		}
+		s.pending = &logRecord{Format: "raw", Message: line}
+	default:
+		s.pending.Traceback += line + "\n"
+	}
+	s.pending.lines = append(s.pending.lines, line)
+
+	if s.timer == nil {
+		s.timer = time.AfterFunc(recordIdle, func() { s.Flush() })
+	} else {
+		s.timer.Reset(recordIdle)
+	}
+
+	return nil
+}
+
+func (s *recordSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flushLocked()
+}
+
+func (s *recordSink) flushLocked() error {
+	record := s.pending
+	s.pending = nil
+	if record == nil || !s.filter.match(record) {
+		return nil
+	}
+
+	if s.filter.JSON {
+		record.Pod = s.pod
+		record.Container = s.container
+		record.Traceback = strings.TrimSuffix(record.Traceback, "\n")
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return s.out.WriteLine("", string(data)+"\n")
+	}
+
+	color := ""
+	if s.out.colors {
+		switch {
+		case levelRank[record.Level] >= levelRank["ERROR"]:
+			color = "31"
+		case levelRank[record.Level] == levelRank["WARNING"]:
+			color = "33"
+		}
+	}
+
+	var text strings.Builder
+	for _, line := range record.lines {
+		if color != "" {
+			line = "\x1b[" + color + "m" + line + "\x1b[0m"
+		}
+		text.WriteString(s.prefix + line + "\n")
+	}
+
+	return s.out.WriteLine("", text.String())
+}
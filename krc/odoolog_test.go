@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want *logRecord
+	}{
+		{
+			"2024-06-01 10:00:00,123 42 INFO shop odoo.modules.loading: 12 modules loaded",
+			&logRecord{Format: "odoo", Time: "2024-06-01 10:00:00,123", PID: 42, Level: "INFO", Database: "shop", Logger: "odoo.modules.loading", Message: "12 modules loaded"},
+		},
+		{
+			"2024-06-01T10:00:00.123456789Z 2024-06-01 10:00:00,123 42 ERROR ? odoo.http: Exception during request handling.",
+			&logRecord{Format: "odoo", Time: "2024-06-01 10:00:00,123", PID: 42, Level: "ERROR", Logger: "odoo.http", Message: "Exception during request handling."},
+		},
+		{
+			"2024-06-01 10:00:00.123 UTC [77] odoo@shop ERROR:  duplicate key value violates unique constraint",
+			&logRecord{Format: "postgres", Time: "2024-06-01 10:00:00.123 UTC", PID: 77, User: "odoo", Database: "shop", Level: "ERROR", Logger: "postgres", Message: "duplicate key value violates unique constraint"},
+		},
+		{"2024-06-01 10:00:00.123 UTC [77] odoo@shop DETAIL:  Key (id)=(1) already exists.", nil},
+		{"Traceback (most recent call last):", nil},
+		{`  File "/usr/lib/python3/dist-packages/odoo/http.py", line 1584, in _serve_db`, nil},
+	}
+	for _, test := range tests {
+		got := parseLogLine(test.line)
+		switch {
+		case got == nil && test.want == nil:
+		case got == nil || test.want == nil:
+			t.Errorf("parseLogLine(%q) = %+v, want %+v", test.line, got, test.want)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("parseLogLine(%q) =\n%+v, want\n%+v", test.line, *got, *test.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// recordSettings turns asciicast recording of interactive sessions on or
+// off on top of the record section of the config.
+type recordSettings struct {
+	Record   bool
+	NoRecord bool
+	Dir      string
+}
+
+func (r *recordSettings) BindFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&r.Record, "record", false, "record the interactive session as an asciicast file")
+	fs.BoolVar(&r.NoRecord, "no-record", false, "do not record the session even if the config enables it")
+	fs.StringVar(&r.Dir, "record-dir", "", "directory for recordings, ~/.local/share/krc/recordings by default")
+}
+
+// resolve returns the directory to record into, or "" when the session is
+// not recorded.
+func (r recordSettings) resolve(cfg recordConfig) (string, error) {
+	if r.NoRecord && cfg.Required {
+		return "", fmt.Errorf("session recording is required by the krc config, --no-record is not allowed")
+	}
+	if r.NoRecord || !(r.Record || cfg.Enabled || cfg.Required) {
+		return "", nil
+	}
+
+	dir := r.Dir
+	if dir == "" {
+		dir = cfg.Dir
+	}
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error locating the recording directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "share", "krc", "recordings")
+	}
+
+	return dir, nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+// startRecording opens a recording of a shell session, nil when recording
+// is off.
+func startRecording(settings recordSettings, client *KubeClient.Client, selected_pod *v1.Pod, container string, command []string, tty KubeClient.TTY) (*KubeClient.Recorder, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := settings.resolve(cfg.Record)
+	if err != nil || dir == "" {
+		return nil, err
+	}
+
+	width, height := 80, 24
+	if size := tty.Size(); size != nil {
+		width, height = int(size.Width), int(size.Height)
+	}
+
+	recorder, err := KubeClient.NewRecorder(dir, KubeClient.CastSession{
+		User:      currentUser(),
+		Cluster:   client.Config.Host,
+		Context:   client.Context,
+		Namespace: selected_pod.Namespace,
+		Pod:       selected_pod.Name,
+		Container: container,
+		Command:   command,
+	}, width, height)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Recording session to %s\n", recorder.Path)
+
+	return recorder, nil
+}
+
+func replayCommand(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	speed := fs.Float64("speed", 1, "playback speed multiplier")
+	idle_limit := fs.Duration("idle-limit", 2*time.Second, "cap pauses to this long, 0 keeps them as recorded")
+	info := fs.Bool("info", false, "only print who recorded the session, where and when")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc replay [--speed X] [--idle-limit D] [--info] <FILE.cast>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *speed <= 0 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header, events, err := KubeClient.ReadCast(f)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", fs.Arg(0), err)
+	}
+
+	if session := header.Session; session != nil {
+		fmt.Fprintf(os.Stderr, "Session of %s in %s/%s (%s) on %s, started %s",
+			session.User, session.Namespace, session.Pod, session.Container, session.Cluster, session.Start.Format(time.RFC3339))
+		if session.End != nil {
+			fmt.Fprintf(os.Stderr, ", ended %s", session.End.Format(time.RFC3339))
+		} else {
+			fmt.Fprint(os.Stderr, ", unfinished")
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	if *info {
+		return nil
+	}
+
+	var last float64
+	for _, event := range events {
+		delay := time.Duration((event.Time - last) / *speed * float64(time.Second))
+		if *idle_limit > 0 && delay > *idle_limit {
+			delay = *idle_limit
+		}
+		time.Sleep(delay)
+		last = event.Time
+
+		if event.Type == "o" {
+			os.Stdout.WriteString(event.Data)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// podSelection narrows the pods of a namespace down to one without asking.
+// Index is -1 when unset.
+type podSelection struct {
+	Pod        string
+	Selector   string
+	App        string
+	FirstReady bool
+	Index      int
+}
+
+func (s *podSelection) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.Pod, "pod", "", "pod name, or a prefix of it")
+	fs.StringVar(&s.Selector, "l", "", "label selector, e.g. app=odoo")
+	fs.StringVar(&s.Selector, "selector", "", "label selector, e.g. app=odoo")
+	fs.StringVar(&s.App, "app", "", "shortcut for -l app=APP")
+	fs.BoolVar(&s.FirstReady, "first-ready", false, "pick the first ready pod among the matches")
+	fs.IntVar(&s.Index, "index", -1, "pick the Nth match, sorted by name")
+}
+
+func (s podSelection) labelSelector() string {
+	var selectors []string
+	if s.Selector != "" {
+		selectors = append(selectors, s.Selector)
+	}
+	if s.App != "" {
+		selectors = append(selectors, "app="+s.App)
+	}
+
+	return strings.Join(selectors, ",")
+}
+
+func (s podSelection) String() string {
+	var parts []string
+	if selector := s.labelSelector(); selector != "" {
+		parts = append(parts, "-l "+selector)
+	}
+	if s.Pod != "" {
+		parts = append(parts, "--pod "+s.Pod)
+	}
+	if len(parts) == 0 {
+		return "any pod"
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// defaultContainerAnnotation names the container kubectl picks by default.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+func bindContainerFlags(fs *flag.FlagSet, container *string) {
+	fs.StringVar(container, "c", "", "container name, asked for when the pod has several")
+	fs.StringVar(container, "container", "", "container name, asked for when the pod has several")
+}
+
+// getContainer resolves the container to use in selected_pod. Init
+// containers are only candidates when with_init is set, as for logs.
+func getContainer(selected_pod *v1.Pod, name string, with_init bool) (string, error) {
+	type candidate struct {
+		name  string
+		image string
+		init  bool
+	}
+
+	var candidates []candidate
+	if with_init {
+		for _, container := range selected_pod.Spec.InitContainers {
+			candidates = append(candidates, candidate{name: container.Name, image: container.Image, init: true})
+		}
+	}
+	for _, container := range selected_pod.Spec.Containers {
+		candidates = append(candidates, candidate{name: container.Name, image: container.Image})
+	}
+
+	if name != "" {
+		for _, c := range candidates {
+			if c.name == name {
+				return name, nil
+			}
+		}
+		for _, container := range selected_pod.Spec.EphemeralContainers {
+			if container.Name == name {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("%w: %s in pod %s", KubeClient.ErrContainerNotFound, name, selected_pod.Name)
+	}
+
+	if len(selected_pod.Spec.Containers) == 1 && len(candidates) == 1 {
+		return candidates[0].name, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		default_container := selected_pod.Annotations[defaultContainerAnnotation]
+		if default_container == "" {
+			default_container = selected_pod.Spec.Containers[0].Name
+		}
+		fmt.Fprintf(os.Stderr, "Defaulted container %q in pod %s, use -c to pick another\n", default_container, selected_pod.Name)
+		return default_container, nil
+	}
+
+	if recent := recentContainer(selected_pod); recent != "" {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].name == recent && candidates[j].name != recent
+		})
+	}
+
+	items := make([]KubeClient.PickerItem, len(candidates))
+	for i, c := range candidates {
+		kind := ""
+		if c.init {
+			kind = "init"
+		}
+		items[i] = KubeClient.PickerItem{Name: c.name, Columns: []string{kind, c.image}}
+	}
+
+	selected_index, err := KubeClient.Picker{
+		Prompt: "Container in " + selected_pod.Name,
+		Header: []string{"NAME", "TYPE", "IMAGE"},
+		Items:  items,
+	}.Run()
+	if err != nil {
+		return "", err
+	}
+
+	return candidates[selected_index].name, nil
+}
+
+func podReady(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// matchPods applies the name, readiness and index filters of sel to pods.
+func matchPods(pods []v1.Pod, sel podSelection) ([]v1.Pod, error) {
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+	if sel.Pod != "" {
+		var matches []v1.Pod
+		for _, pod := range pods {
+			if pod.Name == sel.Pod {
+				matches = []v1.Pod{pod}
+				break
+			}
+			if strings.HasPrefix(pod.Name, sel.Pod) {
+				matches = append(matches, pod)
+			}
+		}
+		pods = matches
+	}
+
+	if sel.FirstReady {
+		for i := range pods {
+			if podReady(&pods[i]) {
+				return pods[i : i+1], nil
+			}
+		}
+		return nil, nil
+	}
+
+	if sel.Index >= 0 {
+		if sel.Index >= len(pods) {
+			return nil, fmt.Errorf("invalid pod index %d, only %d pods match %s", sel.Index, len(pods), sel)
+		}
+		return pods[sel.Index : sel.Index+1], nil
+	}
+
+	return pods, nil
+}
+
+// getPo resolves the pod to work on. Flags in sel pick it directly; the
+// picker is only shown when several pods remain and stdin is a terminal.
+func getPo(clientset kubernetes.Interface, selected_ns string, sel podSelection) (*v1.Pod, error) {
+	return getPoMatching(clientset, selected_ns, sel, "", nil)
+}
+
+// getPoMatching is getPo restricted to the pods keep accepts, kind naming
+// them in messages.
+func getPoMatching(clientset kubernetes.Interface, selected_ns string, sel podSelection, kind string, keep func(*v1.Pod) bool) (*v1.Pod, error) {
+	_, err := KubeClient.GetNamespace(context.Background(), clientset, selected_ns)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := clientset.CoreV1().Pods(selected_ns).List(context.Background(), metav1.ListOptions{
+		LabelSelector: sel.labelSelector(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting pods from namespace %s: %w", selected_ns, KubeClient.Classify(err))
+	}
+
+	candidates := pods.Items
+	if keep != nil {
+		candidates = nil
+		for i := range pods.Items {
+			if keep(&pods.Items[i]) {
+				candidates = append(candidates, pods.Items[i])
+			}
+		}
+	}
+
+	matches, err := matchPods(candidates, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(matches) == 0:
+		return nil, fmt.Errorf("%w: no %spod in namespace %s matches %s", KubeClient.ErrPodNotFound, kind, selected_ns, sel)
+	case len(matches) == 1:
+		return &matches[0], nil
+	case !term.IsTerminal(int(os.Stdin.Fd())):
+		return nil, fmt.Errorf("%d pods in namespace %s match %s, narrow it down with --pod, -l, --app, --first-ready or --index", len(matches), selected_ns, sel)
+	}
+
+	recentPodsFirst(selected_ns, matches)
+	return KubeClient.PickPod("Pod in "+selected_ns, matches)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/v4sr/L0/KubeClient"
+	"github.com/v4sr/L0/KubeClient/fake"
+)
+
+func testPod(name string, ready bool, labels map[string]string) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: labels},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "odoo"}}},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	}
+	if ready {
+		pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	}
+
+	return pod
+}
+
+func podNames(pods []v1.Pod) []string {
+	names := make([]string, len(pods))
+	for i := range pods {
+		names[i] = pods[i].Name
+	}
+
+	return names
+}
+
+func TestMatchPods(t *testing.T) {
+	pods := []v1.Pod{*testPod("odoo-b", true, nil), *testPod("odoo-a", false, nil), *testPod("odoo", false, nil), *testPod("postgres-0", true, nil)}
+
+	tests := []struct {
+		name string
+		sel  podSelection
+		want []string
+	}{
+		{"all sorted", podSelection{Index: -1}, []string{"odoo", "odoo-a", "odoo-b", "postgres-0"}},
+		{"prefix", podSelection{Pod: "odoo-", Index: -1}, []string{"odoo-a", "odoo-b"}},
+		{"exact name wins", podSelection{Pod: "odoo", Index: -1}, []string{"odoo"}},
+		{"first ready", podSelection{Pod: "odoo-", FirstReady: true, Index: -1}, []string{"odoo-b"}},
+		{"none ready", podSelection{Pod: "odoo-a", FirstReady: true, Index: -1}, []string{}},
+		{"index", podSelection{Pod: "odoo-", Index: 1}, []string{"odoo-b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches, err := matchPods(append([]v1.Pod(nil), pods...), test.sel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := podNames(matches); strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("matchPods = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if _, err := matchPods(pods, podSelection{Pod: "odoo-", Index: 2}); err == nil {
+		t.Error("an index past the matches should fail")
+	}
+}
+
+func TestGetPoMatching(t *testing.T) {
+	client, _ := fake.NewClient(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		testPod("odoo-7d9f-abcde", true, map[string]string{"app": "odoo"}),
+		testPod("odoo-7d9f-fghij", false, map[string]string{"app": "odoo"}),
+		testPod("postgres-0", true, map[string]string{"app": "postgres"}),
+	)
+
+	pod, err := getPo(client.Clientset, "shop", podSelection{App: "postgres", Index: -1})
+	if err != nil || pod.Name != "postgres-0" {
+		t.Fatalf("getPo --app postgres = %v, %v", pod, err)
+	}
+
+	pod, err = getPo(client.Clientset, "shop", podSelection{App: "odoo", FirstReady: true, Index: -1})
+	if err != nil || pod.Name != "odoo-7d9f-abcde" {
+		t.Fatalf("getPo --app odoo --first-ready = %v, %v", pod, err)
+	}
+
+	not_postgres := func(pod *v1.Pod) bool { return pod.Labels["app"] != "postgres" }
+	if _, err := getPoMatching(client.Clientset, "shop", podSelection{Pod: "postgres", Index: -1}, "Odoo ", not_postgres); !errors.Is(err, KubeClient.ErrPodNotFound) {
+		t.Errorf("getPoMatching should not offer filtered out pods, got %v", err)
+	}
+
+	// Without a terminal there is nobody to pick from several matches.
+	if _, err := getPo(client.Clientset, "shop", podSelection{App: "odoo", Index: -1}); err == nil {
+		t.Error("getPo should refuse to guess among several pods")
+	}
+
+	if _, err := getPo(client.Clientset, "missing", podSelection{Index: -1}); !errors.Is(err, KubeClient.ErrNamespaceNotFound) {
+		t.Errorf("getPo in a missing namespace = %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/term"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// debugSettings configures the ephemeral debug container used for images
+// that ship no shell.
+type debugSettings struct {
+	Image string
+	Force bool
+}
+
+func (d *debugSettings) BindFlags(fs *flag.FlagSet) {
+	image := os.Getenv("KRC_DEBUG_IMAGE")
+	if image == "" {
+		image = KubeClient.DefaultDebugImage
+	}
+
+	fs.StringVar(&d.Image, "debug-image", image, "toolbox image for ephemeral debug containers (env KRC_DEBUG_IMAGE)")
+	fs.BoolVar(&d.Force, "debug", false, "use an ephemeral debug container even if the container has a shell")
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return false
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// resolveShell returns the container and shell to exec into. When the
+// selected container has no shell it offers, or with --debug goes straight
+// to, an ephemeral debug container sharing its process namespace. Protected
+// namespaces are confirmed first, before the terminal goes raw.
+func resolveShell(ctx context.Context, client *KubeClient.Client, selected_pod *v1.Pod, container string, debug debugSettings, interactive bool) (string, string, error) {
+	if err := client.Guard.Check(ctx, selected_pod.Namespace); err != nil {
+		return "", "", err
+	}
+
+	if !debug.Force {
+		shell, err := KubeClient.DetectShell(ctx, client.Executor, KubeClient.ExecOptions{
+			Namespace: selected_pod.Namespace,
+			Pod:       selected_pod.Name,
+			Container: container,
+		})
+		if !errors.Is(err, KubeClient.ErrNoShell) {
+			return container, shell, err
+		}
+
+		if !interactive || !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", "", fmt.Errorf("%w, rerun with --debug to use a %s debug container", err, debug.Image)
+		}
+		if !confirm(fmt.Sprintf("Container %s has no shell, attach a %s debug container?", container, debug.Image)) {
+			return "", "", err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Starting %s debug container targeting %s...\n", debug.Image, container)
+	debug_container, err := client.AddDebugContainer(ctx, selected_pod, KubeClient.DebugOptions{
+		Image:           debug.Image,
+		TargetContainer: container,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	fmt.Fprintf(os.Stderr, "Attached to %s, the filesystem of %s is under /proc/1/root\n", debug_container, container)
+
+	return debug_container, "sh", nil
+}
+
+// openShell starts an interactive shell in the container.
+func openShell(ctx context.Context, client *KubeClient.Client, selected_pod *v1.Pod, container string, debug debugSettings, record recordSettings) error {
+	container, shell, err := resolveShell(ctx, client, selected_pod, container, debug, true)
+	if err != nil {
+		return err
+	}
+
+	opts := KubeClient.ExecOptions{
+		Namespace: selected_pod.Namespace,
+		Pod:       selected_pod.Name,
+		Container: container,
+		Command:   []string{shell},
+	}
+
+	return runInteractive(ctx, client, selected_pod, opts, record)
+}
+
+// runInteractive runs opts attached to the local terminal. With a terminal
+// it behaves like kubectl exec -it: raw mode, window resizes forwarded and
+// the terminal restored on the way out; otherwise stdin is streamed without
+// a TTY. TTY sessions are recorded when asked to.
+func runInteractive(ctx context.Context, client *KubeClient.Client, selected_pod *v1.Pod, opts KubeClient.ExecOptions, record recordSettings) error {
+	opts.Stdin = os.Stdin
+	opts.Stdout = os.Stdout
+	opts.Stderr = os.Stderr
+
+	tty := KubeClient.TTY{In: os.Stdin, Out: os.Stdout}
+	if !tty.IsTerminal() {
+		fmt.Fprintln(os.Stderr, "Unable to use a TTY, input is not a terminal")
+		return client.Executor.Stream(ctx, opts)
+	}
+
+	recorder, err := startRecording(record, client, selected_pod, opts.Container, opts.Command, tty)
+	if err != nil {
+		return err
+	}
+
+	err = tty.Safe(func(sizes remotecommand.TerminalSizeQueue) error {
+		opts.TTY = true
+		opts.TerminalSizeQueue = sizes
+		if recorder != nil {
+			opts.Stdout = recorder.Tee(os.Stdout)
+			opts.TerminalSizeQueue = recorder.Sizes(sizes)
+		}
+		return client.Executor.Stream(ctx, opts)
+	})
+
+	if recorder != nil {
+		if close_err := recorder.Close(); close_err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving the session recording: %s\n", close_err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Session recorded to %s\n", recorder.Path)
+		}
+	}
+
+	return err
+}
+
+// safeShellWord matches arguments the shell passes through unchanged.
+var safeShellWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// commandLine turns the COMMAND arguments into one shell command line. A
+// single argument is kept as is, so "ls | wc -l" stays a pipeline. Several
+// arguments are quoted one by one, so psql -d db -c "select 1" keeps
+// "select 1" together.
+func commandLine(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+
+	words := make([]string, len(args))
+	for i, arg := range args {
+		if safeShellWord.MatchString(arg) {
+			words[i] = arg
+		} else {
+			words[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// runCommand runs command through the container shell, streaming its output
+// as it comes. Piped stdin is forwarded, so krc can sit in a shell pipeline.
+func runCommand(ctx context.Context, client *KubeClient.Client, selected_pod *v1.Pod, container string, debug debugSettings, command string) error {
+	container, shell, err := resolveShell(ctx, client, selected_pod, container, debug, false)
+	if err != nil {
+		return err
+	}
+
+	opts := KubeClient.ExecOptions{
+		Namespace: selected_pod.Namespace,
+		Pod:       selected_pod.Name,
+		Container: container,
+		Command:   []string{shell, "-c", command},
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		opts.Stdin = os.Stdin
+	}
+
+	return client.Executor.Stream(ctx, opts)
+}
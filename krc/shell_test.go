@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ls | wc -l"}, "ls | wc -l"},
+		{[]string{"ls", "-la", "/var/lib/odoo"}, "ls -la /var/lib/odoo"},
+		{[]string{"psql", "-d", "db", "-c", "select 1"}, "psql -d db -c 'select 1'"},
+		{[]string{"echo", "it's"}, `echo 'it'\''s'`},
+		{[]string{"echo", "$HOME", ""}, `echo '$HOME' ''`},
+	}
+	for _, test := range tests {
+		if got := commandLine(test.args); got != test.want {
+			t.Errorf("commandLine(%q) = %s, want %s", test.args, got, test.want)
+		}
+	}
+}
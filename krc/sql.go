@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// sqlAuditOutput caps the script output kept in the audit log; --output
+// keeps all of it.
+const sqlAuditOutput = 16 << 10
+
+// transactionStatement matches the statements that open or close a
+// transaction, END and ABORT being COMMIT and ROLLBACK in PostgreSQL, and the
+// psql meta-commands that open a new session. ROLLBACK TO SAVEPOINT is fine.
+var transactionStatement = regexp.MustCompile(`(?im)^\s*(BEGIN(\s+(WORK|TRANSACTION))?\s*;|START\s+TRANSACTION\b|(COMMIT|END|ABORT|ROLLBACK)(\s+(WORK|TRANSACTION))?(\s+AND\s+(NO\s+)?CHAIN)?\s*;|PREPARE\s+TRANSACTION\b|COMMIT\s+PREPARED\b|\\(c|connect)(\s|$))`)
+
+// dollarQuoteTag opens a dollar quoted string, such as the body of a
+// function or DO block.
+var dollarQuoteTag = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// transactionControl returns the first statement of script that opens or
+// closes a transaction itself, which would break the BEGIN/COMMIT krc wraps
+// it in, or nil. Dollar quoted bodies are skipped, so PL/pgSQL BEGIN and END
+// blocks are fine.
+func transactionControl(script []byte) []byte {
+	var top []byte
+	for rest := script; len(rest) > 0; {
+		open := dollarQuoteTag.FindIndex(rest)
+		if open == nil {
+			top = append(top, rest...)
+			break
+		}
+		top = append(top, rest[:open[0]]...)
+
+		tag := rest[open[0]:open[1]]
+		rest = rest[open[1]:]
+		end := bytes.Index(rest, tag)
+		if end < 0 {
+			break
+		}
+		// Keep the lines apart so ^ still only matches at line starts.
+		top = append(top, '\n')
+		rest = rest[end+len(tag):]
+	}
+
+	if match := transactionStatement.Find(top); match != nil {
+		return bytes.TrimSpace(match)
+	}
+
+	return nil
+}
+
+// transactionMarker is set for the transaction krc opens only, so a script
+// that ended it, in a way transactionControl missed, fails transactionCheck
+// instead of committing or rolling back nothing.
+const (
+	transactionMarker = "SET LOCAL krc.transaction = 'open';\n"
+	transactionLost   = "krc: the script ended the transaction krc opened"
+	transactionCheck  = "DO $krc$ BEGIN IF current_setting('krc.transaction', true) IS DISTINCT FROM 'open' THEN RAISE EXCEPTION '" + transactionLost + "'; END IF; END $krc$;\n"
+)
+
+// lockedBuffer collects stdout and stderr, written from separate goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func sqlCommand(args []string) error {
+	var clientOpts KubeClient.Options
+	var sel podSelection
+	var container string
+	var record recordSettings
+	fs := flag.NewFlagSet("sql", flag.ExitOnError)
+	database := dbFlags(fs, &clientOpts, &sel, &container, &record)
+	from_odoo := fs.Bool("odoo", false, "run psql in the Odoo pod with its credentials even if there is a Postgres pod")
+	dry_run := fs.Bool("dry-run", false, "run the script and roll it back")
+	output := fs.String("output", "", "also save the output to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc sql [POD SELECTION FLAGS] [--db NAME] [--dry-run] [--output FILE] <NAMESPACE> <FILE.sql>")
+		fmt.Fprintln(fs.Output(), "     runs FILE.sql in one transaction, stopping at the first error")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+	script_path := fs.Arg(1)
+
+	script, err := os.ReadFile(script_path)
+	if err != nil {
+		return fmt.Errorf("error reading SQL script: %w", err)
+	}
+	if match := transactionControl(script); match != nil {
+		return fmt.Errorf("%s manages its own transaction (%q), krc already wraps it in one", script_path, match)
+	}
+	sum := sha256.Sum256(script)
+	hash := hex.EncodeToString(sum[:])
+
+	selected, err := expandNamespace(fs.Arg(0), &clientOpts)
+	if err != nil {
+		return err
+	}
+	applyBookmark(selected, &sel, &container)
+	selected_ns := selected.Namespace
+
+	client, err := KubeClient.NewClient(clientOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	target, err := resolvePsql(ctx, client, selected_ns, sel, container, *from_odoo)
+	if err != nil {
+		return err
+	}
+	defer target.cleanup(client)
+	if err := target.prepare(ctx, client, *database); err != nil {
+		return err
+	}
+
+	end := "COMMIT;\n"
+	mode := "commit"
+	if *dry_run {
+		end = "ROLLBACK;\n"
+		mode = "dry-run"
+	}
+	stdin := io.MultiReader(
+		bytes.NewReader([]byte("BEGIN;\n"+transactionMarker)),
+		bytes.NewReader(script),
+		bytes.NewReader([]byte("\n;\n"+transactionCheck+end)),
+	)
+
+	argv := append(append([]string{"psql"}, psqlArgs(target.creds)...),
+		"-d", target.creds.Database, "-X", "-v", "ON_ERROR_STOP=1", "--echo-queries", "-f", "-")
+
+	fmt.Fprintf(os.Stderr, "Running %s (sha256 %s) on %s in %s/%s, %s\n", filepath.Base(script_path), hash[:12], target.creds.Database, target.pod.Name, target.container, mode)
+
+	captured := &lockedBuffer{}
+	start := time.Now()
+	err = client.Executor.Stream(ctx, KubeClient.ExecOptions{
+		Namespace: target.pod.Namespace,
+		Pod:       target.pod.Name,
+		Container: target.container,
+		Command:   withPassFile(target.pass_file, true, argv),
+		Stdin:     stdin,
+		Stdout:    io.MultiWriter(os.Stdout, captured),
+		Stderr:    io.MultiWriter(os.Stderr, captured),
+	})
+	duration := time.Since(start)
+
+	out := captured.String()
+	details := map[string]string{
+		"script":   script_path,
+		"sha256":   hash,
+		"database": target.creds.Database,
+		"mode":     mode,
+		"output":   out,
+	}
+	if len(out) > sqlAuditOutput {
+		details["output"] = out[len(out)-sqlAuditOutput:]
+		details["output_truncated"] = strconv.Itoa(len(out))
+	}
+	if *output != "" {
+		details["output_file"] = *output
+		if write_err := os.WriteFile(*output, []byte(out), 0o600); write_err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving the output: %s\n", write_err)
+		}
+	}
+
+	entry := KubeClient.AuditEntry{
+		Time:      start,
+		Action:    "sql",
+		Namespace: target.pod.Namespace,
+		Pod:       target.pod.Name,
+		Container: target.container,
+		Duration:  duration.Seconds(),
+		Details:   details,
+	}
+	var exit_err *KubeClient.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exit_err):
+		entry.ExitCode = exit_err.Code
+	default:
+		entry.ExitCode = -1
+		entry.Error = err.Error()
+	}
+	client.Audit.Record(entry)
+
+	if err != nil {
+		if strings.Contains(out, "ERROR:  "+transactionLost) {
+			fmt.Fprintln(os.Stderr, "The script left the krc transaction, what it did before may be committed")
+		} else {
+			fmt.Fprintln(os.Stderr, "Script failed, the transaction was rolled back")
+		}
+		return err
+	}
+	if *dry_run {
+		fmt.Fprintln(os.Stderr, "Dry run, the transaction was rolled back")
+	} else {
+		fmt.Fprintln(os.Stderr, "Committed")
+	}
+
+	return nil
+}
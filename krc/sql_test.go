@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestTransactionControl(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"UPDATE res_users SET active = false WHERE id = 7;\n", ""},
+		{"begin;\nupdate t set a = 1;\n", "begin;"},
+		{"START TRANSACTION ISOLATION LEVEL SERIALIZABLE;", "START TRANSACTION"},
+		{"update t set a = 1;\ncommit;\n", "commit;"},
+		{"update t set a = 1;\nEND;\n", "END;"},
+		{"ABORT WORK;", "ABORT WORK;"},
+		{"COMMIT AND CHAIN;", "COMMIT AND CHAIN;"},
+		{"PREPARE TRANSACTION 'x';", "PREPARE TRANSACTION"},
+		{"\\c other_db\nupdate t set a = 1;\n", `\c`},
+		{"\\connect other_db", `\connect`},
+		{"SAVEPOINT a;\nupdate t set a = 1;\nROLLBACK TO SAVEPOINT a;\n", ""},
+		{"CREATE FUNCTION f() RETURNS void AS $$\nBEGIN\n  PERFORM 1;\nEND;\n$$ LANGUAGE plpgsql;\n", ""},
+		{"DO $body$\nBEGIN\n  COMMIT;\nEND;\n$body$;\n", ""},
+		{"DO $$\nBEGIN\nEND;\n$$;\nEND;\n", "END;"},
+		{"-- commit; in a comment\nselect 1;", ""},
+	}
+	for _, test := range tests {
+		if got := string(transactionControl([]byte(test.script))); got != test.want {
+			t.Errorf("transactionControl(%q) = %q, want %q", test.script, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// defaultSyncIgnore are never pushed; --ignore adds to them.
+var defaultSyncIgnore = []string{".git", "__pycache__", "*.pyc", "*.swp", "*~", ".#*"}
+
+// defaultAddonsDir is where the official Odoo image looks for extra addons.
+const defaultAddonsDir = "/mnt/extra-addons"
+
+type fileState struct {
+	size int64
+	mod  time.Time
+	mode fs.FileMode
+}
+
+// ignored reports whether rel, a slash separated path below the synced
+// directory, matches a pattern by its base name or as a whole.
+func ignored(patterns []string, rel string) bool {
+	base := path.Base(rel)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, base); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, rel); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanTree records every file below root that is not ignored.
+func scanTree(root string, patterns []string) (map[string]fileState, error) {
+	files := map[string]fileState{}
+	err := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		// Files removed during the walk are noticed by the next scan.
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		if ignored(patterns, filepath.ToSlash(rel)) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files[file] = fileState{size: info.Size(), mod: info.ModTime(), mode: info.Mode()}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s: %w", root, err)
+	}
+
+	return files, nil
+}
+
+// diffTrees lists the files added or modified in after, and the files of
+// before that are gone, both sorted.
+func diffTrees(before map[string]fileState, after map[string]fileState) ([]string, []string) {
+	var changed, removed []string
+	for file, state := range after {
+		if previous, found := before[file]; !found || previous != state {
+			changed = append(changed, file)
+		}
+	}
+	for file := range before {
+		if _, found := after[file]; !found {
+			removed = append(removed, file)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+
+	return changed, removed
+}
+
+// extraAddons picks the directory custom addons belong to from an Odoo
+// addons_path: the first entry that is not part of the Odoo sources.
+func extraAddons(addons_path string) string {
+	for _, dir := range strings.Split(addons_path, ",") {
+		dir = path.Clean(strings.TrimSpace(dir))
+		if dir == "." || strings.Contains(dir, "-packages/") || strings.HasSuffix(dir, "odoo/addons") {
+			continue
+		}
+		return dir
+	}
+
+	return defaultAddonsDir
+}
+
+// isModule reports whether dir is an Odoo module rather than a directory of
+// modules.
+func isModule(dir string) bool {
+	for _, manifest := range []string{"__manifest__.py", "__openerp__.py"} {
+		if _, err := os.Stat(filepath.Join(dir, manifest)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// syncer pushes the changes of a local addons directory, or of a single
+// module, into an Odoo container.
+type syncer struct {
+	client *KubeClient.Client
+	local  string
+	dest   KubeClient.PodPath
+	module bool
+	// update is "", "changed" for the modules touched by each batch, or a
+	// comma separated list of modules.
+	update   string
+	restart  bool
+	odoo_bin string
+	// target reaches the database when modules are updated.
+	target *dbTarget
+}
+
+// modules lists the modules the files belong to.
+func (s *syncer) modules(files []string) []string {
+	if s.module {
+		return []string{filepath.Base(s.local)}
+	}
+
+	seen := map[string]bool{}
+	var modules []string
+	for _, file := range files {
+		rel, err := filepath.Rel(s.local, file)
+		if err != nil {
+			continue
+		}
+		module, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+		if nested && !seen[module] {
+			seen[module] = true
+			modules = append(modules, module)
+		}
+	}
+	sort.Strings(modules)
+
+	return modules
+}
+
+// push copies changed into the pod and deletes removed there. An error
+// means the batch may have arrived in part only, so it has to be sent again.
+func (s *syncer) push(ctx context.Context, changed []string, removed []string) error {
+	if len(changed) > 0 {
+		if err := KubeClient.CopyFiles(ctx, s.client.Executor, s.local, changed, s.dest, KubeClient.CopyOptions{}); err != nil {
+			return err
+		}
+	}
+
+	if len(removed) > 0 {
+		command := []string{"sh", "-c", `cd "$1" && shift && rm -f -- "$@"`, "sh", s.dest.Path}
+		for _, file := range removed {
+			rel, err := filepath.Rel(s.local, file)
+			if err != nil {
+				return err
+			}
+			command = append(command, filepath.ToSlash(rel))
+		}
+		_, stderr, err := KubeClient.Run(ctx, s.client.Executor, KubeClient.ExecOptions{
+			Namespace: s.dest.Namespace,
+			Pod:       s.dest.Pod,
+			Container: s.dest.Container,
+			Command:   command,
+		})
+		if err != nil {
+			return fmt.Errorf("error removing %d files from %s: %w: %s", len(removed), s.dest, err, strings.TrimSpace(stderr))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%s Pushed %d files, removed %d in %s\n", time.Now().Format("15:04:05"), len(changed), len(removed), s.dest)
+
+	return nil
+}
+
+// apply updates modules and restarts Odoo as asked once a batch is in the
+// pod.
+func (s *syncer) apply(ctx context.Context, changed []string, removed []string) error {
+	if s.update != "" {
+		modules := s.update
+		if modules == "changed" {
+			modules = strings.Join(s.modules(append(changed, removed...)), ",")
+		}
+		if modules != "" {
+			if err := s.updateModules(ctx, modules); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.restart {
+		_, stderr, err := KubeClient.Run(ctx, s.client.Executor, KubeClient.ExecOptions{
+			Namespace: s.dest.Namespace,
+			Pod:       s.dest.Pod,
+			Container: s.dest.Container,
+			Command:   []string{"kill", "-HUP", "1"},
+		})
+		if err != nil {
+			return fmt.Errorf("error restarting Odoo: %w: %s", err, strings.TrimSpace(stderr))
+		}
+		fmt.Fprintln(os.Stderr, "Restarted Odoo")
+	}
+
+	return nil
+}
+
+// updateModules runs odoo -u next to the running server, without HTTP so
+// the ports do not clash.
+func (s *syncer) updateModules(ctx context.Context, modules string) error {
+	fmt.Fprintf(os.Stderr, "Updating %s on %s\n", modules, s.target.creds.Database)
+
+	argv := append(odooArgs(s.odoo_bin, s.target.creds), "-u", modules, "--stop-after-init", "--no-http")
+	err := s.client.Executor.Stream(ctx, KubeClient.ExecOptions{
+		Namespace: s.dest.Namespace,
+		Pod:       s.dest.Pod,
+		Container: s.dest.Container,
+		Command:   withPassFile(s.target.pass_file, false, argv),
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating %s: %w", modules, err)
+	}
+
+	return nil
+}
+
+// watch polls the local tree every interval and pushes a batch once a scan
+// finds no new changes, so a save touching many files goes out at once.
+func (s *syncer) watch(ctx context.Context, interval time.Duration, patterns []string, pushed map[string]fileState) error {
+	seen := pushed
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := scanTree(s.local, patterns)
+		if err != nil {
+			return err
+		}
+		if changed, removed := diffTrees(seen, current); len(changed)+len(removed) > 0 {
+			seen = current
+			continue
+		}
+
+		changed, removed := diffTrees(pushed, current)
+		if len(changed)+len(removed) == 0 {
+			continue
+		}
+		if err := s.push(ctx, changed, removed); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// pushed stays as it was, so the next scan sends the whole
+			// batch again.
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			continue
+		}
+		pushed = current
+
+		// The files are in the pod, a failed update waits for the next
+		// change instead of being retried on every scan.
+		if err := s.apply(ctx, changed, removed); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+	}
+}
+
+func syncCommand(args []string) error {
+	var clientOpts KubeClient.Options
+	var sel podSelection
+	var container string
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	clientOpts.BindFlags(fs)
+	sel.BindFlags(fs)
+	bindContainerFlags(fs, &container)
+	dest := fs.String("dest", "", "addons directory in the pod, by default the first custom entry of addons_path or "+defaultAddonsDir)
+	patterns := append([]string{}, defaultSyncIgnore...)
+	fs.Func("ignore", "skip files or directories matching this pattern, may be repeated (always skipped: "+strings.Join(defaultSyncIgnore, " ")+")", func(pattern string) error {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+		patterns = append(patterns, pattern)
+		return nil
+	})
+	interval := fs.Duration("interval", time.Second, "how often to look for changes")
+	skip_initial := fs.Bool("skip-initial", false, "do not push the whole directory when starting")
+	update := fs.String("update", "", `modules to update after each batch, comma separated, or "changed" for the modules touched`)
+	restart := fs.Bool("restart", false, "restart Odoo (kill -HUP 1) after each batch")
+	database := fs.String("db", "", "database to update modules in, asked for when there are several")
+	odoo_bin := fs.String("odoo-bin", "odoo", "Odoo executable in the container, e.g. odoo-bin for source installs")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc sync [POD SELECTION FLAGS] [-c CONTAINER] [--dest PATH] [--ignore PATTERN]... [--update MODULES|changed] [--restart] <NAMESPACE> <LOCAL_DIR>")
+		fmt.Fprintln(fs.Output(), "     LOCAL_DIR is a directory of addons, or a single addon")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 || *interval <= 0 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+	selected, err := expandNamespace(fs.Arg(0), &clientOpts)
+	if err != nil {
+		return err
+	}
+	applyBookmark(selected, &sel, &container)
+	selected_ns := selected.Namespace
+	local, err := filepath.Abs(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(local); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", fs.Arg(1))
+	}
+
+	client, err := KubeClient.NewClient(clientOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s := &syncer{
+		client:   client,
+		local:    local,
+		module:   isModule(local),
+		update:   *update,
+		restart:  *restart,
+		odoo_bin: *odoo_bin,
+	}
+
+	pod, container, err := odooContainer(client.Clientset, selected_ns, sel, container)
+	if err != nil {
+		return err
+	}
+	// Ask about protected namespaces now rather than at the first save.
+	if err := client.Guard.Check(ctx, pod.Namespace); err != nil {
+		return err
+	}
+
+	addons := *dest
+	if addons == "" {
+		env, err := containerEnv(ctx, client.Clientset, pod, container)
+		if err != nil {
+			return err
+		}
+		_, conf, err := readOdooConf(ctx, client, pod, container, env)
+		if err != nil {
+			return err
+		}
+		addons = extraAddons(conf["addons_path"])
+	}
+	if s.module {
+		addons = path.Join(addons, filepath.Base(local))
+	}
+	s.dest = KubeClient.PodPath{Namespace: pod.Namespace, Pod: pod.Name, Container: container, Path: addons}
+
+	if s.update != "" {
+		creds, err := odooCredentials(ctx, client, pod, container)
+		if err != nil {
+			return err
+		}
+		s.target = &dbTarget{pod: pod, container: container, creds: creds}
+		defer s.target.cleanup(client)
+		if err := s.target.prepare(ctx, client, *database); err != nil {
+			return err
+		}
+	}
+
+	pushed, err := scanTree(local, patterns)
+	if err != nil {
+		return err
+	}
+	if *skip_initial {
+		fmt.Fprintf(os.Stderr, "Watching %s for %s\n", local, s.dest)
+	} else {
+		files := make([]string, 0, len(pushed))
+		for file := range pushed {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		if err := s.push(ctx, files, nil); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Press Ctrl-C to stop")
+
+	return s.watch(ctx, *interval, patterns, pushed)
+}
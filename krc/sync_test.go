@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffTrees(t *testing.T) {
+	now := time.Now()
+	before := map[string]fileState{
+		"/src/sale/models.py":   {size: 10, mod: now},
+		"/src/sale/views.xml":   {size: 20, mod: now},
+		"/src/stock/models.py":  {size: 30, mod: now},
+		"/src/stock/wizard.py":  {size: 40, mod: now},
+		"/src/stock/report.xml": {size: 50, mod: now, mode: 0o644},
+	}
+	after := map[string]fileState{
+		"/src/sale/models.py":   {size: 10, mod: now},
+		"/src/sale/views.xml":   {size: 21, mod: now},
+		"/src/stock/models.py":  {size: 30, mod: now.Add(time.Second)},
+		"/src/stock/report.xml": {size: 50, mod: now, mode: 0o755},
+		"/src/stock/new.py":     {size: 1, mod: now},
+	}
+
+	changed, removed := diffTrees(before, after)
+	if got := strings.Join(changed, " "); got != "/src/sale/views.xml /src/stock/models.py /src/stock/new.py /src/stock/report.xml" {
+		t.Errorf("changed %s", got)
+	}
+	if got := strings.Join(removed, " "); got != "/src/stock/wizard.py" {
+		t.Errorf("removed %s", got)
+	}
+
+	if changed, removed := diffTrees(after, after); len(changed)+len(removed) != 0 {
+		t.Errorf("no change expected, got %v %v", changed, removed)
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	for rel, want := range map[string]bool{
+		"sale/__pycache__":         true,
+		"sale/models.pyc":          true,
+		".git":                     true,
+		"sale/models.py":           false,
+		"sale/static/src/app.js~":  true,
+		"sale/static/src/.#app.js": true,
+	} {
+		if got := ignored(defaultSyncIgnore, rel); got != want {
+			t.Errorf("ignored(%s) = %v", rel, got)
+		}
+	}
+}
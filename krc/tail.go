@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/v4sr/L0/KubeClient"
+)
+
+// tailResync makes the informer replay every pod periodically, so streams
+// that dropped while their container kept running get reattached.
+const tailResync = 30 * time.Second
+
+var tailColors = []string{"31", "32", "33", "34", "35", "36", "91", "92", "93", "94", "95", "96"}
+
+func colorize(text string, enabled bool) string {
+	if !enabled {
+		return text
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(text))
+	return "\x1b[" + tailColors[h.Sum32()%uint32(len(tailColors))] + "m" + text + "\x1b[0m"
+}
+
+type tailTarget struct {
+	pod       string
+	container string
+}
+
+type tailStream struct {
+	cancel context.CancelFunc
+}
+
+// tailer follows the logs of every container of a changing set of pods.
+type tailer struct {
+	ctx       context.Context
+	clientset kubernetes.Interface
+	settings  logSettings
+	container string
+	prefix    string
+	out       *lineWriter
+
+	mu      sync.Mutex
+	streams map[tailTarget]*tailStream
+	// ended remembers when the last stream of a container stopped, so a
+	// reattach only prints what came after it.
+	ended map[tailTarget]time.Time
+	wg    sync.WaitGroup
+}
+
+func (t *tailer) matches(pod *v1.Pod) bool {
+	return strings.HasPrefix(pod.Name, t.prefix)
+}
+
+// sync attaches to the containers of pod that have logs to show.
+func (t *tailer) sync(pod *v1.Pod) {
+	if !t.matches(pod) {
+		return
+	}
+
+	statuses := pod.Status.ContainerStatuses
+	if t.settings.AllContainers {
+		statuses = append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), statuses...)
+	}
+
+	for _, status := range statuses {
+		if t.container != "" && status.Name != t.container {
+			continue
+		}
+		if status.State.Running == nil && status.State.Terminated == nil {
+			continue
+		}
+		t.attach(pod, status.Name, status.State.Running != nil)
+	}
+}
+
+func (t *tailer) attach(pod *v1.Pod, container string, running bool) {
+	key := tailTarget{pod: pod.Name, container: container}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, found := t.streams[key]; found {
+		return
+	}
+	opts, err := t.settings.podLogOptions(container)
+	if err != nil {
+		return
+	}
+	if ended, found := t.ended[key]; found {
+		if !running {
+			return
+		}
+		opts.TailLines = nil
+		opts.SinceSeconds = nil
+		opts.SinceTime = &metav1.Time{Time: ended}
+	}
+
+	ctx, cancel := context.WithCancel(t.ctx)
+	stream := &tailStream{cancel: cancel}
+	t.streams[key] = stream
+
+	prefix := colorize(pod.Name, t.out.colors) + " " + colorize(container, t.out.colors) + " "
+	fmt.Fprintf(os.Stderr, "+ %s %s\n", pod.Name, container)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer cancel()
+
+		err := streamLogs(ctx, t.clientset, pod, opts, t.settings.sink(t.out, pod, container, prefix))
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+
+		t.mu.Lock()
+		if t.streams[key] == stream {
+			delete(t.streams, key)
+			t.ended[key] = time.Now()
+		}
+		t.mu.Unlock()
+	}()
+}
+
+// detach stops following a deleted pod.
+func (t *tailer) detach(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, stream := range t.streams {
+		if key.pod == name {
+			stream.cancel()
+			delete(t.streams, key)
+			fmt.Fprintf(os.Stderr, "- %s %s\n", key.pod, key.container)
+		}
+	}
+	for key := range t.ended {
+		if key.pod == name {
+			delete(t.ended, key)
+		}
+	}
+}
+
+func tailCommand(args []string) error {
+	var clientOpts KubeClient.Options
+	// tail has no --index, leave it unset for applyBookmark.
+	sel := podSelection{Index: -1}
+	var container string
+	var logs logSettings
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	clientOpts.BindFlags(fs)
+	fs.StringVar(&sel.Pod, "pod", "", "only pods whose name starts with this prefix")
+	fs.StringVar(&sel.Selector, "l", "", "label selector, e.g. app=odoo")
+	fs.StringVar(&sel.Selector, "selector", "", "label selector, e.g. app=odoo")
+	fs.StringVar(&sel.App, "app", "", "shortcut for -l app=APP")
+	fs.StringVar(&container, "c", "", "only this container, every container by default")
+	fs.StringVar(&container, "container", "", "only this container, every container by default")
+	logs.BindFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "use: ./krc tail [-l SELECTOR] [--app APP] [--pod PREFIX] [-c CONTAINER] [LOG FLAGS] <NAMESPACE>")
+		fmt.Fprintln(fs.Output(), "     follows every matching pod, attaching to new ones as they start")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(KubeClient.ExitUsage)
+	}
+	selected, err := expandNamespace(fs.Arg(0), &clientOpts)
+	if err != nil {
+		return err
+	}
+	applyBookmark(selected, &sel, &container)
+	selected_ns := selected.Namespace
+
+	if _, err := logs.podLogOptions(container); err != nil {
+		return err
+	}
+
+	client, err := KubeClient.NewClient(clientOpts)
+	if err != nil {
+		return err
+	}
+	clientset := client.Clientset
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if _, err := KubeClient.GetNamespace(ctx, clientset, selected_ns); err != nil {
+		return err
+	}
+
+	selector := sel.labelSelector()
+	pod_list, err := clientset.CoreV1().Pods(selected_ns).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("error listing pods in %s: %w", selected_ns, KubeClient.Classify(err))
+	}
+
+	out, closeOutput, err := openLogOutput(logs, "pods matching "+sel.String())
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	t := &tailer{
+		ctx:       ctx,
+		clientset: clientset,
+		settings:  logs,
+		container: container,
+		prefix:    sel.Pod,
+		out:       out,
+		streams:   map[tailTarget]*tailStream{},
+		ended:     map[tailTarget]time.Time{},
+	}
+
+	if logs.NoFollow || logs.Previous {
+		for i := range pod_list.Items {
+			t.sync(&pod_list.Items[i])
+		}
+		t.wg.Wait()
+		return nil
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, tailResync,
+		informers.WithNamespace(selected_ns),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = selector
+		}))
+	informer := factory.Core().V1().Pods().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*v1.Pod); ok {
+				t.sync(pod)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if pod, ok := obj.(*v1.Pod); ok {
+				t.sync(pod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*v1.Pod); ok {
+				t.detach(pod.Name)
+			}
+		},
+	})
+
+	if len(pod_list.Items) == 0 {
+		fmt.Fprintf(os.Stderr, "No pods match %s in %s yet, waiting for them\n", sel.String(), selected_ns)
+	}
+
+	factory.Start(ctx.Done())
+	<-ctx.Done()
+	factory.Shutdown()
+	t.wg.Wait()
+
+	return nil
+}